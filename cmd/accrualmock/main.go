@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/accrualmock"
+	liblog "github.com/ArtShib/gophermart.git/internal/lib/logger"
+)
+
+func main() {
+	address := flag.String("a", envOr("RUN_ADDRESS", ":8081"), "HTTP server startup address")
+	scenarioPath := flag.String("s", os.Getenv("ACCRUAL_MOCK_SCENARIO"), "scenario file (JSON)")
+	flag.Parse()
+
+	logger := liblog.New()
+
+	scenario := accrualmock.DefaultScenario()
+	if *scenarioPath != "" {
+		loaded, err := accrualmock.LoadScenario(*scenarioPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scenario = loaded
+	}
+
+	server := &http.Server{
+		Addr:    *address,
+		Handler: accrualmock.New(logger, scenario),
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		logger.Info("accrual mock started", "address", *address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error(err.Error())
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
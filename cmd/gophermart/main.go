@@ -16,7 +16,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	cfg := config.MustLoadConfig()
-	store, err := storage.New(ctx, cfg.DatabaseDSN)
+	store, err := storage.New(ctx, cfg.DatabaseDSN, cfg.Points.LifetimeMonths)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/deadletter"
+	"github.com/ArtShib/gophermart.git/internal/services/ledger"
+	"github.com/ArtShib/gophermart.git/internal/services/refund"
+	"github.com/ArtShib/gophermart.git/internal/storage"
+)
+
+const usage = `usage: gophermartctl [-d DATABASE_URI] [-m POINTS_LIFETIME_MONTHS] <command> [args]
+
+commands:
+  deadletter list               list dead-lettered orders
+  deadletter show <number>      show a dead-lettered order
+  deadletter requeue <number>   return a dead-lettered order to accrual polling
+  ledger statement <user-id> [limit] [offset]
+                                show a user's ledger postings, newest first
+  ledger adjust <user-id> <amount> <reason>
+                                post a manual balance adjustment (negative to debit)
+  ledger check                  recompute balances from the ledger and report drift
+  withdrawal reverse <number> <sum|all> <operator> <reason>
+                                return withdrawn points to the user, fully or partially
+`
+
+func main() {
+	dsn := flag.String("d", os.Getenv("DATABASE_URI"), "DataBase connection string")
+	lifetime := flag.Int("m", pointsLifetimeMonths(), "lifetime of credited points in months, 0 to never expire")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	store, err := storage.New(ctx, *dsn, *lifetime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	if err := run(ctx, log, store, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func pointsLifetimeMonths() int {
+	if months, err := strconv.Atoi(os.Getenv("POINTS_LIFETIME_MONTHS")); err == nil {
+		return months
+	}
+	return config.DefaultPointsLifetimeMonths
+}
+
+func run(ctx context.Context, log *slog.Logger, store storage.Storage, args []string) error {
+	switch args[0] {
+	case "deadletter":
+		return runDeadLetter(ctx, deadletter.New(log, store), args[1:])
+	case "ledger":
+		return runLedger(ctx, ledger.New(log, store), args[1:])
+	case "withdrawal":
+		return runWithdrawal(ctx, refund.New(log, store), args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func runDeadLetter(ctx context.Context, svc *deadletter.DeadLetter, args []string) error {
+	switch args[0] {
+	case "list":
+		orders, err := svc.List(ctx)
+		if err != nil {
+			if errors.Is(err, models.ErrDeadLetterEmpty) {
+				fmt.Println("[]")
+				return nil
+			}
+			return err
+		}
+		return printJSON(orders)
+	case "show", "requeue":
+		if len(args) < 2 {
+			return fmt.Errorf("deadletter %s: order number is required", args[0])
+		}
+		number, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("deadletter %s: %w", args[0], models.ErrNotValidOrderNumber)
+		}
+		if args[0] == "requeue" {
+			if err := svc.Requeue(ctx, number); err != nil {
+				return err
+			}
+			fmt.Printf("order %d requeued\n", number)
+			return nil
+		}
+		order, err := svc.Get(ctx, number)
+		if err != nil {
+			return err
+		}
+		return printJSON(order)
+	}
+	return fmt.Errorf("unknown deadletter command %q", args[0])
+}
+
+func runLedger(ctx context.Context, svc *ledger.Ledger, args []string) error {
+	if args[0] == "check" {
+		drifts, err := svc.CheckBalances(ctx)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(drifts); err != nil {
+			return err
+		}
+		if len(drifts) > 0 {
+			return fmt.Errorf("ledger check: %d balances drifted", len(drifts))
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("ledger %s: user id is required", args[0])
+	}
+	userID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ledger %s: invalid user id %q", args[0], args[1])
+	}
+
+	switch args[0] {
+	case "statement":
+		limit, offset := 50, 0
+		if len(args) > 2 {
+			if limit, err = strconv.Atoi(args[2]); err != nil || limit <= 0 {
+				return fmt.Errorf("ledger statement: invalid limit %q", args[2])
+			}
+		}
+		if len(args) > 3 {
+			if offset, err = strconv.Atoi(args[3]); err != nil || offset < 0 {
+				return fmt.Errorf("ledger statement: invalid offset %q", args[3])
+			}
+		}
+		entries, err := svc.Statement(ctx, userID, limit, offset)
+		if err != nil {
+			if errors.Is(err, models.ErrStatementEmpty) {
+				fmt.Println("[]")
+				return nil
+			}
+			return err
+		}
+		return printJSON(entries)
+	case "adjust":
+		if len(args) < 4 {
+			return fmt.Errorf("ledger adjust: amount and reason are required")
+		}
+		amount, err := models.ParseMoney(args[2])
+		if err != nil {
+			return fmt.Errorf("ledger adjust: %w", err)
+		}
+		reason := strings.Join(args[3:], " ")
+		if err := svc.Adjust(ctx, userID, amount, reason); err != nil {
+			return err
+		}
+		fmt.Printf("user %d adjusted by %s\n", userID, amount)
+		return nil
+	}
+	return fmt.Errorf("unknown ledger command %q", args[0])
+}
+
+func runWithdrawal(ctx context.Context, svc *refund.Refund, args []string) error {
+	if args[0] != "reverse" {
+		return fmt.Errorf("unknown withdrawal command %q", args[0])
+	}
+	if len(args) < 5 {
+		return fmt.Errorf("withdrawal reverse: number, sum, operator and reason are required")
+	}
+	number, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("withdrawal reverse: %w", models.ErrNotValidOrderNumber)
+	}
+	var sum models.Money
+	if args[2] != "all" {
+		if sum, err = models.ParseMoney(args[2]); err != nil {
+			return fmt.Errorf("withdrawal reverse: %w", err)
+		}
+		if sum <= 0 {
+			return fmt.Errorf("withdrawal reverse: %w", models.ErrInvalidReversal)
+		}
+	}
+	reversal, err := svc.Reverse(ctx, number, sum, args[3], strings.Join(args[4:], " "))
+	if err != nil {
+		return err
+	}
+	return printJSON(reversal)
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
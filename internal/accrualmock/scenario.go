@@ -0,0 +1,89 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Step struct {
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+	After   Duration `json:"after"`
+}
+
+type OrderScript struct {
+	Unknown   bool     `json:"unknown"`
+	Steps     []Step   `json:"steps"`
+	Delay     Duration `json:"delay"`
+	FailFirst int      `json:"fail_first"`
+}
+
+type Throttle struct {
+	RequestsPerMinute int      `json:"requests_per_minute"`
+	RetryAfter        Duration `json:"retry_after"`
+}
+
+type Scenario struct {
+	Default  *OrderScript           `json:"default"`
+	Orders   map[string]OrderScript `json:"orders"`
+	Throttle *Throttle              `json:"throttle"`
+	Delay    Duration               `json:"delay"`
+}
+
+func DefaultScenario() Scenario {
+	accrual := 500.0
+	return Scenario{
+		Default: &OrderScript{
+			Steps: []Step{
+				{Status: "REGISTERED"},
+				{Status: "PROCESSING", After: Duration(time.Second)},
+				{Status: "PROCESSED", Accrual: &accrual, After: Duration(2 * time.Second)},
+			},
+		},
+		Orders: map[string]OrderScript{},
+	}
+}
+
+func LoadScenario(path string) (Scenario, error) {
+	const op = "accrualmock.LoadScenario"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("%s: %w", op, err)
+	}
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return Scenario{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for number := range scenario.Orders {
+		if _, err := strconv.ParseInt(number, 10, 64); err != nil {
+			return Scenario{}, fmt.Errorf("%s: invalid order number %q", op, number)
+		}
+	}
+	if scenario.Orders == nil {
+		scenario.Orders = map[string]OrderScript{}
+	}
+	return scenario, nil
+}
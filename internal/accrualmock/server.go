@@ -0,0 +1,188 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ordersPath = "/api/orders/"
+
+type Server struct {
+	log         *slog.Logger
+	mu          sync.Mutex
+	scenario    Scenario
+	firstSeen   map[int64]time.Time
+	requests    map[int64]int
+	windowStart time.Time
+	windowCount int
+	now         func() time.Time
+}
+
+func New(log *slog.Logger, scenario Scenario) *Server {
+	if scenario.Orders == nil {
+		scenario.Orders = map[string]OrderScript{}
+	}
+	return &Server{
+		log:       log,
+		scenario:  scenario,
+		firstSeen: make(map[int64]time.Time),
+		requests:  make(map[int64]int),
+		now:       time.Now,
+	}
+}
+
+func (s *Server) SetOrder(number int64, script OrderScript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.Orders[strconv.FormatInt(number, 10)] = script
+	delete(s.firstSeen, number)
+	delete(s.requests, number)
+}
+
+func (s *Server) SetThrottle(throttle *Throttle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.Throttle = throttle
+	s.windowStart = time.Time{}
+	s.windowCount = 0
+}
+
+func (s *Server) Requests(number int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[number]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const op = "accrualmock.ServeHTTP"
+
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, ordersPath) {
+		http.NotFound(w, r)
+		return
+	}
+	number, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, ordersPath), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	res := s.respond(number)
+	if s.log != nil {
+		s.log.Debug(op, "number", number, "status_code", res.code, "status", res.status)
+	}
+
+	if res.delay > 0 {
+		select {
+		case <-time.After(res.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch res.code {
+	case http.StatusTooManyRequests:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", strconv.Itoa(int(res.retryAfter.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", res.quota)
+	case http.StatusOK:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Order   string   `json:"order"`
+			Status  string   `json:"status"`
+			Accrual *float64 `json:"accrual,omitempty"`
+		}{
+			Order:   strconv.FormatInt(number, 10),
+			Status:  res.status,
+			Accrual: res.accrual,
+		})
+	case http.StatusNoContent:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(res.code), res.code)
+	}
+}
+
+type response struct {
+	code       int
+	status     string
+	accrual    *float64
+	delay      time.Duration
+	retryAfter time.Duration
+	quota      int
+}
+
+func (s *Server) respond(number int64) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	res := response{delay: time.Duration(s.scenario.Delay)}
+
+	if throttle := s.scenario.Throttle; throttle != nil && throttle.RequestsPerMinute > 0 {
+		if now.Sub(s.windowStart) >= time.Minute {
+			s.windowStart = now
+			s.windowCount = 0
+		}
+		s.windowCount++
+		if s.windowCount > throttle.RequestsPerMinute {
+			res.code = http.StatusTooManyRequests
+			res.quota = throttle.RequestsPerMinute
+			res.retryAfter = time.Duration(throttle.RetryAfter)
+			if res.retryAfter == 0 {
+				res.retryAfter = time.Minute - now.Sub(s.windowStart)
+			}
+			return res
+		}
+	}
+
+	s.requests[number]++
+	script, ok := s.scenario.Orders[strconv.FormatInt(number, 10)]
+	if !ok {
+		if s.scenario.Default == nil {
+			res.code = http.StatusNoContent
+			return res
+		}
+		script = *s.scenario.Default
+	}
+	if script.Delay > 0 {
+		res.delay = time.Duration(script.Delay)
+	}
+	if s.requests[number] <= script.FailFirst {
+		res.code = http.StatusInternalServerError
+		return res
+	}
+	if script.Unknown {
+		res.code = http.StatusNoContent
+		return res
+	}
+
+	first, ok := s.firstSeen[number]
+	if !ok {
+		first = now
+		s.firstSeen[number] = first
+	}
+	elapsed := now.Sub(first)
+
+	var current *Step
+	for i := range script.Steps {
+		if time.Duration(script.Steps[i].After) <= elapsed {
+			current = &script.Steps[i]
+		}
+	}
+	if current == nil {
+		res.code = http.StatusNoContent
+		return res
+	}
+	res.code = http.StatusOK
+	res.status = current.Status
+	res.accrual = current.Accrual
+	return res
+}
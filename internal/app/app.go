@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"log"
 	"log/slog"
 	"net/http"
 	"time"
@@ -10,9 +11,17 @@ import (
 	"github.com/ArtShib/gophermart.git/internal/httpclient"
 	"github.com/ArtShib/gophermart.git/internal/httpserver"
 	liblog "github.com/ArtShib/gophermart.git/internal/lib/logger"
+	"github.com/ArtShib/gophermart.git/internal/models"
 	"github.com/ArtShib/gophermart.git/internal/services/accrual"
 	"github.com/ArtShib/gophermart.git/internal/services/auth"
+	"github.com/ArtShib/gophermart.git/internal/services/campaign"
+	"github.com/ArtShib/gophermart.git/internal/services/housekeeping"
 	"github.com/ArtShib/gophermart.git/internal/services/order"
+	"github.com/ArtShib/gophermart.git/internal/services/outbox"
+	"github.com/ArtShib/gophermart.git/internal/services/referral"
+	"github.com/ArtShib/gophermart.git/internal/services/refund"
+	"github.com/ArtShib/gophermart.git/internal/services/tier"
+	"github.com/ArtShib/gophermart.git/internal/services/transfer"
 	"github.com/ArtShib/gophermart.git/internal/storage"
 )
 
@@ -20,10 +29,17 @@ type App struct {
 	Logger     *slog.Logger
 	Storage    storage.Storage
 	Server     *http.Server
+	Admin      *http.Server
 	Config     *config.Config
 	AuthSvc    *auth.Auth
 	OrderSvc   *order.Order
 	AccrualSvc *accrual.ClientAccrual
+	TierSvc    *tier.Tier
+	Campaigns  *campaign.Campaign
+	Transfers  *transfer.Transfer
+	Referrals  *referral.Referral
+	Janitor    *housekeeping.Housekeeping
+	Outbox     *outbox.Outbox
 }
 
 func NewApp(cfg *config.Config, store *storage.Storage) *App {
@@ -33,31 +49,99 @@ func NewApp(cfg *config.Config, store *storage.Storage) *App {
 	}
 	app.Logger = liblog.New()
 	app.AuthSvc = auth.New(app.Logger, app.Storage, cfg.TokenTTLMIN*time.Minute)
-	app.OrderSvc = order.New(app.Logger, app.Storage)
-	client := httpclient.New(app.Logger)
-	app.AccrualSvc = accrual.New(app.Logger, app.Storage, app.Config.WorkerConfig, client, app.Config.AccrualAddress)
+	app.OrderSvc = order.New(app.Logger, app.Storage, cfg.Points)
+	providers, err := accrual.NewRegistry(app.Logger, app.Config.WorkerConfig, func(timeout time.Duration) accrual.HTTPClient {
+		return httpclient.New(app.Logger, timeout)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.AccrualSvc = accrual.New(app.Logger, app.Storage, app.Config.WorkerConfig, providers)
+	app.TierSvc, err = tier.New(app.Logger, app.Storage, cfg.Tiers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.TierSvc.Subscribe(func(ctx context.Context, change models.TierChange) {
+		app.Logger.Info("user tier changed",
+			slog.Int64("user_id", change.UserID),
+			slog.String("from", change.From),
+			slog.String("to", change.To),
+			slog.String("lifetime_accrual", change.LifetimeAccrual.String()))
+	})
+	app.Outbox = outbox.New(app.Logger, app.Storage, cfg.Outbox)
+	app.Outbox.Register("tiers", app.TierSvc.OnProcessed)
+	app.AccrualSvc.Subscribe(app.Outbox.OnProcessed)
+	app.Campaigns, err = campaign.New(app.Logger, app.Storage, app.TierSvc, cfg.Campaigns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Outbox.Register("campaigns", app.Campaigns.OnProcessed)
+	app.Transfers, err = transfer.New(app.Logger, app.Storage, cfg.Transfer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Referrals, err = referral.New(app.Logger, app.Storage, cfg.Referral)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Outbox.Register("referrals", app.Referrals.OnProcessed)
+	app.Janitor = housekeeping.New(app.Logger, cfg.Housekeeping.Interval)
+	app.Janitor.Register("idempotency_keys",
+		housekeeping.PurgeIdempotencyKeys(app.Logger, app.Storage, cfg.Housekeeping.IdempotencyTTL))
+	app.Janitor.Register("accrual_callback_signatures",
+		housekeeping.PurgeCallbackSignatures(app.Logger, app.Storage))
+	app.Janitor.Register("withdrawal_reservations",
+		housekeeping.ExpireReservations(app.Logger, app.Storage))
+	app.Janitor.Register("point_lots",
+		housekeeping.ExpirePoints(app.Logger, app.Storage))
 	app.Server = &http.Server{
 		Addr:    cfg.HTTPServer.Address,
-		Handler: httpserver.New(app.AuthSvc, app.OrderSvc, app.Logger, app.Config),
+		Handler: httpserver.New(app.AuthSvc, app.OrderSvc, app.TierSvc, app.Transfers, app.Referrals, app.AccrualSvc, app.Storage, app.Storage, app.Logger, app.Config),
+	}
+	if cfg.AdminAddress != "" {
+		operators, err := cfg.AdminOperators()
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.Admin = &http.Server{
+			Addr:    cfg.AdminAddress,
+			Handler: httpserver.NewAdmin(app.AccrualSvc, refund.New(app.Logger, app.Storage), operators, app.Logger),
+		}
 	}
 	return app
 }
 
 func (a *App) Run(ctx context.Context) {
 	a.AccrualSvc.Start(ctx)
+	a.Outbox.Start(ctx)
+	a.Janitor.Start(ctx)
 	go func() {
 		if err := a.Server.ListenAndServe(); err != nil {
 			a.Logger.Error(err.Error())
 		}
 
 	}()
+	if a.Admin != nil {
+		go func() {
+			if err := a.Admin.ListenAndServe(); err != nil {
+				a.Logger.Error(err.Error())
+			}
+		}()
+	}
 }
 
 func (a *App) Stop(ctx context.Context) {
 	if err := a.Server.Shutdown(ctx); err != nil {
 		a.Logger.Error(err.Error())
 	}
+	if a.Admin != nil {
+		if err := a.Admin.Shutdown(ctx); err != nil {
+			a.Logger.Error(err.Error())
+		}
+	}
 	a.AccrualSvc.Stop()
+	a.Outbox.Stop()
+	a.Janitor.Stop()
 	if err := a.Storage.Close(); err != nil {
 		a.Logger.Error(err.Error())
 	}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type CampaignConfig struct {
+	Name           string
+	StartsAt       time.Time
+	EndsAt         time.Time
+	Multiplier     json.Number
+	Bonus          json.Number
+	NewUsersWithin time.Duration
+	Tiers          []string
+	MinOrders      int
+	MaxOrders      int
+	Stackable      bool
+}
+
+func (c *CampaignConfig) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Name           string      `json:"name"`
+		StartsAt       time.Time   `json:"starts_at"`
+		EndsAt         time.Time   `json:"ends_at"`
+		Multiplier     json.Number `json:"multiplier"`
+		Bonus          json.Number `json:"bonus"`
+		NewUsersWithin string      `json:"new_users_within"`
+		Tiers          []string    `json:"tiers"`
+		MinOrders      int         `json:"min_orders"`
+		MaxOrders      int         `json:"max_orders"`
+		Stackable      bool        `json:"stackable"`
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	c.Name = aux.Name
+	c.StartsAt = aux.StartsAt
+	c.EndsAt = aux.EndsAt
+	c.Multiplier = aux.Multiplier
+	c.Bonus = aux.Bonus
+	c.Tiers = aux.Tiers
+	c.MinOrders = aux.MinOrders
+	c.MaxOrders = aux.MaxOrders
+	c.Stackable = aux.Stackable
+
+	if aux.NewUsersWithin != "" {
+		within, err := time.ParseDuration(aux.NewUsersWithin)
+		if err != nil {
+			return err
+		}
+		c.NewUsersWithin = within
+	}
+	return nil
+}
+
+type CampaignsConfig struct {
+	File      string `env:"CAMPAIGNS_FILE"`
+	Campaigns []CampaignConfig
+}
+
+type campaignsFile struct {
+	Campaigns []CampaignConfig `json:"campaigns"`
+}
+
+func (c *Config) LoadCampaigns() error {
+	const op = "config.LoadCampaigns"
+
+	if c.Campaigns.File == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.Campaigns.File)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var file campaignsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	c.Campaigns.Campaigns = file.Campaigns
+	return nil
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env"
@@ -15,7 +18,17 @@ type Config struct {
 	TokenTTLMIN    time.Duration `env:"TOKEN_TTL_MIN"`
 	SecretKey      []byte
 	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	AdminAddress   string `env:"ADMIN_ADDRESS"`
+	AdminTokens    string `env:"ADMIN_TOKENS"`
+	CallbackSecret string `env:"ACCRUAL_CALLBACK_SECRET"`
 	WorkerConfig   WorkerConfig
+	Housekeeping   HousekeepingConfig
+	Outbox         OutboxConfig
+	Points         PointsConfig
+	Tiers          TiersConfig
+	Campaigns      CampaignsConfig
+	Transfer       TransferConfig
+	Referral       ReferralConfig
 }
 
 type HTTPServer struct {
@@ -25,10 +38,76 @@ type HTTPServer struct {
 }
 
 type WorkerConfig struct {
-	CountWorkers   int32
-	InputChainSize int
-	BufferSize     int
-	BatchSize      int
+	MinWorkers         int           `env:"ACCRUAL_MIN_WORKERS"`
+	MaxWorkers         int           `env:"ACCRUAL_MAX_WORKERS"`
+	WorkerIdleTimeout  time.Duration `env:"ACCRUAL_WORKER_IDLE_TIMEOUT"`
+	InputChainSize     int
+	BufferSize         int
+	BatchSize          int
+	NotRegisteredGrace time.Duration `env:"ACCRUAL_NOT_REGISTERED_GRACE"`
+	InstanceID         string        `env:"ACCRUAL_INSTANCE_ID"`
+	LeaseTTL           time.Duration `env:"ACCRUAL_LEASE_TTL"`
+	PollBaseDelay      time.Duration `env:"ACCRUAL_POLL_BASE_DELAY"`
+	PollMaxDelay       time.Duration `env:"ACCRUAL_POLL_MAX_DELAY"`
+	MaxFailures        int           `env:"ACCRUAL_MAX_FAILURES"`
+	BreakerFailures    int           `env:"ACCRUAL_BREAKER_FAILURES"`
+	BreakerOpenTimeout time.Duration `env:"ACCRUAL_BREAKER_OPEN_TIMEOUT"`
+	BreakerHalfOpen    int           `env:"ACCRUAL_BREAKER_HALF_OPEN_REQUESTS"`
+	RateLimit          float64       `env:"ACCRUAL_RATE_LIMIT"`
+	RateBurst          int           `env:"ACCRUAL_RATE_BURST"`
+	ProvidersFile      string        `env:"ACCRUAL_PROVIDERS_FILE"`
+	DefaultProvider    string
+	Providers          []ProviderConfig
+	Routes             []RouteConfig
+}
+
+const DefaultPointsLifetimeMonths = 12
+
+type HousekeepingConfig struct {
+	Interval       time.Duration `env:"HOUSEKEEPING_INTERVAL"`
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL"`
+}
+
+// OutboxConfig drives delivery of processed-order events to the services that
+// credit bonuses on them.
+type OutboxConfig struct {
+	Interval       time.Duration `env:"OUTBOX_INTERVAL"`
+	BatchSize      int           `env:"OUTBOX_BATCH_SIZE"`
+	LeaseTTL       time.Duration `env:"OUTBOX_LEASE_TTL"`
+	RetryBaseDelay time.Duration `env:"OUTBOX_RETRY_BASE_DELAY"`
+	RetryMaxDelay  time.Duration `env:"OUTBOX_RETRY_MAX_DELAY"`
+}
+
+func (o OutboxConfig) Validate() error {
+	if o.Interval <= 0 {
+		return fmt.Errorf("OUTBOX_INTERVAL must be positive, got %s", o.Interval)
+	}
+	if o.BatchSize < 1 {
+		return fmt.Errorf("OUTBOX_BATCH_SIZE must be at least 1, got %d", o.BatchSize)
+	}
+	if o.LeaseTTL <= 0 {
+		return fmt.Errorf("OUTBOX_LEASE_TTL must be positive, got %s", o.LeaseTTL)
+	}
+	if o.RetryBaseDelay <= 0 || o.RetryMaxDelay < o.RetryBaseDelay {
+		return fmt.Errorf("OUTBOX_RETRY_BASE_DELAY (%s) must be positive and not exceed OUTBOX_RETRY_MAX_DELAY (%s)", o.RetryBaseDelay, o.RetryMaxDelay)
+	}
+	return nil
+}
+
+type PointsConfig struct {
+	ReservationTTL time.Duration `env:"RESERVATION_TTL"`
+	LifetimeMonths int           `env:"POINTS_LIFETIME_MONTHS"`
+	ExpiringWindow time.Duration `env:"POINTS_EXPIRING_WINDOW"`
+}
+
+type TransferConfig struct {
+	DailyLimit string `env:"TRANSFER_DAILY_LIMIT"`
+	DailyCount int    `env:"TRANSFER_DAILY_COUNT"`
+}
+
+type ReferralConfig struct {
+	ReferrerBonus string `env:"REFERRAL_REFERRER_BONUS"`
+	RefereeBonus  string `env:"REFERRAL_REFEREE_BONUS"`
 }
 
 func (c *Config) LoadConfigEnv() error {
@@ -46,6 +125,108 @@ func (c *Config) LoadConfigEnv() error {
 	}
 	return nil
 }
+
+func (c *Config) LoadWorkerConfigEnv() error {
+	return env.Parse(&c.WorkerConfig)
+}
+
+// AdminOperators maps each admin token to its operator. ADMIN_TOKENS holds
+// comma-separated operator:token pairs.
+func (c *Config) AdminOperators() (map[string]string, error) {
+	operators := make(map[string]string)
+	for i, pair := range strings.Split(c.AdminTokens, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		operator, token, ok := strings.Cut(pair, ":")
+		operator, token = strings.TrimSpace(operator), strings.TrimSpace(token)
+		if !ok || operator == "" || token == "" {
+			return nil, fmt.Errorf("ADMIN_TOKENS: entry %d is not operator:token", i+1)
+		}
+		if _, ok := operators[token]; ok {
+			return nil, fmt.Errorf("ADMIN_TOKENS: operator %q reuses a token", operator)
+		}
+		operators[token] = operator
+	}
+	if len(operators) == 0 {
+		return nil, fmt.Errorf("ADMIN_TOKENS must list at least one operator:token pair")
+	}
+	return operators, nil
+}
+
+func (w WorkerConfig) Validate() error {
+	if w.MaxWorkers < 1 {
+		return fmt.Errorf("ACCRUAL_MAX_WORKERS must be at least 1, got %d", w.MaxWorkers)
+	}
+	if w.MinWorkers < 0 {
+		return fmt.Errorf("ACCRUAL_MIN_WORKERS must not be negative, got %d", w.MinWorkers)
+	}
+	if w.MinWorkers > w.MaxWorkers {
+		return fmt.Errorf("ACCRUAL_MIN_WORKERS (%d) must not exceed ACCRUAL_MAX_WORKERS (%d)", w.MinWorkers, w.MaxWorkers)
+	}
+	if w.WorkerIdleTimeout <= 0 {
+		return fmt.Errorf("ACCRUAL_WORKER_IDLE_TIMEOUT must be positive, got %s", w.WorkerIdleTimeout)
+	}
+	if w.NotRegisteredGrace <= 0 {
+		return fmt.Errorf("ACCRUAL_NOT_REGISTERED_GRACE must be positive, got %s", w.NotRegisteredGrace)
+	}
+	// Leases are stored in whole seconds, so anything shorter would be no lease at all.
+	if w.LeaseTTL < time.Second {
+		return fmt.Errorf("ACCRUAL_LEASE_TTL must be at least 1s, got %s", w.LeaseTTL)
+	}
+	if w.PollBaseDelay <= 0 || w.PollMaxDelay < w.PollBaseDelay {
+		return fmt.Errorf("ACCRUAL_POLL_BASE_DELAY (%s) must be positive and not exceed ACCRUAL_POLL_MAX_DELAY (%s)", w.PollBaseDelay, w.PollMaxDelay)
+	}
+	if w.MaxFailures < 1 {
+		return fmt.Errorf("ACCRUAL_MAX_FAILURES must be at least 1, got %d", w.MaxFailures)
+	}
+	if w.BreakerFailures < 1 {
+		return fmt.Errorf("ACCRUAL_BREAKER_FAILURES must be at least 1, got %d", w.BreakerFailures)
+	}
+	if w.BreakerOpenTimeout <= 0 {
+		return fmt.Errorf("ACCRUAL_BREAKER_OPEN_TIMEOUT must be positive, got %s", w.BreakerOpenTimeout)
+	}
+	if w.BreakerHalfOpen < 1 {
+		return fmt.Errorf("ACCRUAL_BREAKER_HALF_OPEN_REQUESTS must be at least 1, got %d", w.BreakerHalfOpen)
+	}
+	if w.RateLimit < 0 {
+		return fmt.Errorf("ACCRUAL_RATE_LIMIT must not be negative, got %g", w.RateLimit)
+	}
+	if w.RateBurst < 0 {
+		return fmt.Errorf("ACCRUAL_RATE_BURST must not be negative, got %d", w.RateBurst)
+	}
+	return nil
+}
+
+func (c *Config) LoadHousekeepingConfigEnv() error {
+	return env.Parse(&c.Housekeeping)
+}
+
+func (c *Config) LoadPointsConfigEnv() error {
+	return env.Parse(&c.Points)
+}
+
+func (c *Config) LoadTiersConfigEnv() error {
+	return env.Parse(&c.Tiers)
+}
+
+func (c *Config) LoadCampaignsConfigEnv() error {
+	return env.Parse(&c.Campaigns)
+}
+
+func (c *Config) LoadOutboxConfigEnv() error {
+	return env.Parse(&c.Outbox)
+}
+
+func (c *Config) LoadTransferConfigEnv() error {
+	return env.Parse(&c.Transfer)
+}
+
+func (c *Config) LoadReferralConfigEnv() error {
+	return env.Parse(&c.Referral)
+}
+
 func (c *Config) LoadConfigFlag() {
 	if c.HTTPServer.Address == "" {
 		flag.StringVar(&c.HTTPServer.Address, "a", "", "HTTP server startup address")
@@ -66,17 +247,88 @@ func MustLoadConfig() *Config {
 		},
 		DatabaseDSN:    os.Getenv("DATABASE_URI"),
 		AccrualAddress: os.Getenv("ACCRUAL_SYSTEM_ADDRESS"),
+		AdminAddress:   os.Getenv("ADMIN_ADDRESS"),
+		AdminTokens:    os.Getenv("ADMIN_TOKENS"),
+		CallbackSecret: os.Getenv("ACCRUAL_CALLBACK_SECRET"),
 		SecretKey:      []byte("sDfmldsnflkm<M SAD !2scxzcx#454556%$^%^&%*"),
 		TokenTTLMIN:    15,
 		WorkerConfig: WorkerConfig{
-			CountWorkers:   3,
-			InputChainSize: 20,
-			BufferSize:     10,
-			BatchSize:      10,
+			MinWorkers:         1,
+			MaxWorkers:         3,
+			WorkerIdleTimeout:  30 * time.Second,
+			InputChainSize:     20,
+			BufferSize:         10,
+			BatchSize:          10,
+			NotRegisteredGrace: 24 * time.Hour,
+			InstanceID:         instanceID(),
+			LeaseTTL:           30 * time.Second,
+			PollBaseDelay:      time.Second,
+			PollMaxDelay:       10 * time.Minute,
+			MaxFailures:        10,
+			BreakerFailures:    5,
+			BreakerOpenTimeout: 30 * time.Second,
+			BreakerHalfOpen:    1,
+			RateLimit:          0,
+			RateBurst:          5,
+		},
+		Housekeeping: HousekeepingConfig{
+			Interval:       time.Minute,
+			IdempotencyTTL: 24 * time.Hour,
+		},
+		Outbox: OutboxConfig{
+			Interval:       time.Second,
+			BatchSize:      100,
+			LeaseTTL:       time.Minute,
+			RetryBaseDelay: 5 * time.Second,
+			RetryMaxDelay:  10 * time.Minute,
+		},
+		Points: PointsConfig{
+			ReservationTTL: 15 * time.Minute,
+			LifetimeMonths: DefaultPointsLifetimeMonths,
+			ExpiringWindow: 30 * 24 * time.Hour,
+		},
+		Transfer: TransferConfig{
+			DailyLimit: "1000",
+			DailyCount: 5,
+		},
+		Referral: ReferralConfig{
+			ReferrerBonus: "0",
+			RefereeBonus:  "0",
 		},
 	}
 	cfg.LoadConfigEnv()
+	cfg.LoadWorkerConfigEnv()
+	cfg.LoadHousekeepingConfigEnv()
+	cfg.LoadOutboxConfigEnv()
+	cfg.LoadPointsConfigEnv()
+	cfg.LoadTiersConfigEnv()
+	cfg.LoadCampaignsConfigEnv()
+	cfg.LoadTransferConfigEnv()
+	cfg.LoadReferralConfigEnv()
 	cfg.LoadConfigFlag()
+	if err := cfg.WorkerConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Outbox.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.LoadProviders(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.LoadTiers(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.LoadCampaigns(); err != nil {
+		log.Fatal(err)
+	}
 
 	return &cfg
 }
+
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
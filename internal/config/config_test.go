@@ -0,0 +1,116 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+		wantErr  bool
+	}{
+		{name: "defaults", min: 1, max: 3},
+		{name: "fixed pool", min: 2, max: 2},
+		{name: "scale from zero", min: 0, max: 1},
+		{name: "no workers", min: 0, max: 0, wantErr: true},
+		{name: "negative max", min: 0, max: -1, wantErr: true},
+		{name: "negative min", min: -1, max: 3, wantErr: true},
+		{name: "min above max", min: 4, max: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := validWorkerConfig()
+		cfg.MinWorkers, cfg.MaxWorkers = tt.min, tt.max
+		err := cfg.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWorkerConfigValidatePolicy(t *testing.T) {
+	tests := map[string]func(*WorkerConfig){
+		"no idle timeout":       func(c *WorkerConfig) { c.WorkerIdleTimeout = 0 },
+		"no grace":              func(c *WorkerConfig) { c.NotRegisteredGrace = 0 },
+		"sub-second lease":      func(c *WorkerConfig) { c.LeaseTTL = 500 * time.Millisecond },
+		"no poll delay":         func(c *WorkerConfig) { c.PollBaseDelay = 0 },
+		"poll max below base":   func(c *WorkerConfig) { c.PollMaxDelay = time.Millisecond },
+		"no failures allowed":   func(c *WorkerConfig) { c.MaxFailures = 0 },
+		"no breaker threshold":  func(c *WorkerConfig) { c.BreakerFailures = 0 },
+		"no breaker timeout":    func(c *WorkerConfig) { c.BreakerOpenTimeout = 0 },
+		"no half-open requests": func(c *WorkerConfig) { c.BreakerHalfOpen = 0 },
+		"negative rate":         func(c *WorkerConfig) { c.RateLimit = -1 },
+		"negative burst":        func(c *WorkerConfig) { c.RateBurst = -1 },
+	}
+	for name, mutate := range tests {
+		cfg := validWorkerConfig()
+		mutate(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func validWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		MinWorkers:         1,
+		MaxWorkers:         3,
+		WorkerIdleTimeout:  30 * time.Second,
+		NotRegisteredGrace: 24 * time.Hour,
+		LeaseTTL:           30 * time.Second,
+		PollBaseDelay:      time.Second,
+		PollMaxDelay:       10 * time.Minute,
+		MaxFailures:        10,
+		BreakerFailures:    5,
+		BreakerOpenTimeout: 30 * time.Second,
+		BreakerHalfOpen:    1,
+		RateBurst:          5,
+	}
+}
+
+func TestAdminOperators(t *testing.T) {
+	cfg := Config{AdminTokens: " alice:token-a, bob:token-b ,"}
+	operators, err := cfg.AdminOperators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operators) != 2 || operators["token-a"] != "alice" || operators["token-b"] != "bob" {
+		t.Fatalf("operators: got %v", operators)
+	}
+
+	for _, tokens := range []string{"", "alice", "alice:", ":token", "alice:t,bob:t"} {
+		cfg := Config{AdminTokens: tokens}
+		if _, err := cfg.AdminOperators(); err == nil {
+			t.Errorf("%q: want error", tokens)
+		}
+	}
+}
+
+func TestOutboxConfigValidate(t *testing.T) {
+	valid := OutboxConfig{
+		Interval:       time.Second,
+		BatchSize:      100,
+		LeaseTTL:       time.Minute,
+		RetryBaseDelay: time.Second,
+		RetryMaxDelay:  time.Minute,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := map[string]func(*OutboxConfig){
+		"no interval":    func(c *OutboxConfig) { c.Interval = 0 },
+		"empty batch":    func(c *OutboxConfig) { c.BatchSize = 0 },
+		"no lease":       func(c *OutboxConfig) { c.LeaseTTL = 0 },
+		"no retry delay": func(c *OutboxConfig) { c.RetryBaseDelay = 0 },
+		"max below base": func(c *OutboxConfig) { c.RetryMaxDelay = time.Millisecond },
+	}
+	for name, mutate := range tests {
+		cfg := valid
+		mutate(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	DefaultProviderName = "default"
+	DefaultProviderPath = "/api/orders/{number}"
+	defaultTimeout      = 3 * time.Second
+)
+
+type ProviderConfig struct {
+	Name      string
+	URL       string
+	Path      string
+	Timeout   time.Duration
+	RateLimit float64
+	RateBurst int
+}
+
+func (p *ProviderConfig) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Name      string  `json:"name"`
+		URL       string  `json:"url"`
+		Path      string  `json:"path"`
+		Timeout   string  `json:"timeout"`
+		RateLimit float64 `json:"rate_limit"`
+		RateBurst int     `json:"rate_burst"`
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	p.Name = aux.Name
+	p.URL = aux.URL
+	p.Path = aux.Path
+	p.RateLimit = aux.RateLimit
+	p.RateBurst = aux.RateBurst
+
+	if aux.Timeout != "" {
+		timeout, err := time.ParseDuration(aux.Timeout)
+		if err != nil {
+			return err
+		}
+		p.Timeout = timeout
+	}
+	return nil
+}
+
+type RouteConfig struct {
+	Provider string  `json:"provider"`
+	Prefix   string  `json:"prefix"`
+	UserIDs  []int64 `json:"user_ids"`
+}
+
+type providersFile struct {
+	Default   string           `json:"default"`
+	Providers []ProviderConfig `json:"providers"`
+	Routes    []RouteConfig    `json:"routes"`
+}
+
+func (c *Config) LoadProviders() error {
+	const op = "config.LoadProviders"
+
+	w := &c.WorkerConfig
+	w.DefaultProvider = DefaultProviderName
+	w.Providers = []ProviderConfig{c.withProviderDefaults(ProviderConfig{
+		Name: DefaultProviderName,
+		URL:  c.AccrualAddress,
+	})}
+
+	if w.ProvidersFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(w.ProvidersFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var file providersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, provider := range file.Providers {
+		if provider.Name == "" || provider.URL == "" {
+			return fmt.Errorf("%s: provider name and url are required", op)
+		}
+		provider = c.withProviderDefaults(provider)
+		if provider.Name == DefaultProviderName {
+			w.Providers[0] = provider
+			continue
+		}
+		w.Providers = append(w.Providers, provider)
+	}
+	if file.Default != "" {
+		w.DefaultProvider = file.Default
+	}
+	w.Routes = file.Routes
+	return nil
+}
+
+func (c *Config) withProviderDefaults(p ProviderConfig) ProviderConfig {
+	if p.Path == "" {
+		p.Path = DefaultProviderPath
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultTimeout
+	}
+	if p.RateLimit == 0 {
+		p.RateLimit = c.WorkerConfig.RateLimit
+	}
+	if p.RateBurst == 0 {
+		p.RateBurst = c.WorkerConfig.RateBurst
+	}
+	return p
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type TierConfig struct {
+	Name      string      `json:"name"`
+	Threshold json.Number `json:"threshold"`
+	Perks     []string    `json:"perks"`
+}
+
+type TiersConfig struct {
+	File  string `env:"LOYALTY_TIERS_FILE"`
+	Tiers []TierConfig
+}
+
+type tiersFile struct {
+	Tiers []TierConfig `json:"tiers"`
+}
+
+func DefaultTiers() []TierConfig {
+	return []TierConfig{
+		{Name: "bronze", Threshold: "0"},
+		{Name: "silver", Threshold: "1000", Perks: []string{"priority_support"}},
+		{Name: "gold", Threshold: "5000", Perks: []string{"priority_support", "free_delivery"}},
+	}
+}
+
+func (c *Config) LoadTiers() error {
+	const op = "config.LoadTiers"
+
+	if c.Tiers.File == "" {
+		c.Tiers.Tiers = DefaultTiers()
+		return nil
+	}
+
+	data, err := os.ReadFile(c.Tiers.File)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var file tiersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(file.Tiers) == 0 {
+		return fmt.Errorf("%s: at least one tier is required", op)
+	}
+	c.Tiers.Tiers = file.Tiers
+	return nil
+}
@@ -0,0 +1,287 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/accrualmock"
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/httpclient"
+	"github.com/ArtShib/gophermart.git/internal/httpserver"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/middleware/idempotency"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/accrual"
+	"github.com/ArtShib/gophermart.git/internal/services/auth"
+	"github.com/ArtShib/gophermart.git/internal/services/campaign"
+	"github.com/ArtShib/gophermart.git/internal/services/order"
+	"github.com/ArtShib/gophermart.git/internal/services/outbox"
+	"github.com/ArtShib/gophermart.git/internal/services/referral"
+	"github.com/ArtShib/gophermart.git/internal/services/tier"
+	"github.com/ArtShib/gophermart.git/internal/services/transfer"
+	"github.com/ArtShib/gophermart.git/internal/storage"
+)
+
+const waitTimeout = 10 * time.Second
+
+type env struct {
+	t      *testing.T
+	server *httptest.Server
+	mock   *accrualmock.Server
+	store  storage.Storage
+	tier   *tier.Tier
+}
+
+func newEnv(t *testing.T, scenario accrualmock.Scenario, opts ...func(*config.Config)) *env {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mock := accrualmock.New(log, scenario)
+	mockServer := httptest.NewServer(mock)
+	t.Cleanup(mockServer.Close)
+
+	cfg := &config.Config{
+		SecretKey: []byte("e2e-secret"),
+		Housekeeping: config.HousekeepingConfig{
+			Interval:       time.Minute,
+			IdempotencyTTL: time.Hour,
+		},
+		Outbox: config.OutboxConfig{
+			Interval:       50 * time.Millisecond,
+			BatchSize:      10,
+			LeaseTTL:       time.Second,
+			RetryBaseDelay: 10 * time.Millisecond,
+			RetryMaxDelay:  50 * time.Millisecond,
+		},
+		Points: config.PointsConfig{
+			ReservationTTL: time.Minute,
+			LifetimeMonths: config.DefaultPointsLifetimeMonths,
+		},
+		Tiers: config.TiersConfig{
+			Tiers: config.DefaultTiers(),
+		},
+		Transfer: config.TransferConfig{
+			DailyLimit: "1000",
+			DailyCount: 5,
+		},
+		WorkerConfig: config.WorkerConfig{
+			MinWorkers:         1,
+			MaxWorkers:         3,
+			WorkerIdleTimeout:  time.Second,
+			InputChainSize:     20,
+			BufferSize:         10,
+			BatchSize:          10,
+			InstanceID:         "e2e",
+			LeaseTTL:           5 * time.Second,
+			PollBaseDelay:      10 * time.Millisecond,
+			PollMaxDelay:       50 * time.Millisecond,
+			MaxFailures:        3,
+			BreakerFailures:    10,
+			BreakerOpenTimeout: 100 * time.Millisecond,
+			BreakerHalfOpen:    1,
+			RateBurst:          5,
+			DefaultProvider:    config.DefaultProviderName,
+			Providers: []config.ProviderConfig{{
+				Name:      config.DefaultProviderName,
+				URL:       mockServer.URL,
+				Path:      config.DefaultProviderPath,
+				Timeout:   time.Second,
+				RateBurst: 5,
+			}},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	store := storage.NewMemory(cfg.Points.LifetimeMonths)
+	providers, err := accrual.NewRegistry(log, cfg.WorkerConfig, func(timeout time.Duration) accrual.HTTPClient {
+		return httpclient.New(log, timeout)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accrualSvc := accrual.New(log, store, cfg.WorkerConfig, providers)
+	authSvc := auth.New(log, store, time.Hour)
+	orderSvc := order.New(log, store, cfg.Points)
+	tierSvc, err := tier.New(log, store, cfg.Tiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outboxSvc := outbox.New(log, store, cfg.Outbox)
+	outboxSvc.Register("tiers", tierSvc.OnProcessed)
+	accrualSvc.Subscribe(outboxSvc.OnProcessed)
+	campaignSvc, err := campaign.New(log, store, tierSvc, cfg.Campaigns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outboxSvc.Register("campaigns", campaignSvc.OnProcessed)
+	transferSvc, err := transfer.New(log, store, cfg.Transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	referralSvc, err := referral.New(log, store, cfg.Referral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outboxSvc.Register("referrals", referralSvc.OnProcessed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	accrualSvc.Start(ctx)
+	outboxSvc.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		accrualSvc.Stop()
+		outboxSvc.Stop()
+	})
+
+	server := httptest.NewServer(httpserver.New(authSvc, orderSvc, tierSvc, transferSvc, referralSvc, accrualSvc, store, store, log, cfg))
+	t.Cleanup(server.Close)
+
+	return &env{t: t, server: server, mock: mock, store: store, tier: tierSvc}
+}
+
+func (e *env) do(method, path, token, contentType, body string) (int, []byte) {
+	e.t.Helper()
+
+	req, err := http.NewRequest(method, e.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+func (e *env) doIdempotent(method, path, token, contentType, key, body string) (int, http.Header) {
+	e.t.Helper()
+
+	req, err := http.NewRequest(method, e.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", token)
+	req.Header.Set(idempotency.HeaderKey, key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		e.t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header
+}
+
+func (e *env) register(login string) string {
+	e.t.Helper()
+
+	code, token := e.registerReferred(login, "")
+	if code != http.StatusOK {
+		e.t.Fatalf("register %s: status %d", login, code)
+	}
+	return token
+}
+
+func (e *env) registerReferred(login, referralCode string) (int, string) {
+	e.t.Helper()
+
+	body, _ := json.Marshal(models.RequestUser{Login: login, Password: "secret", ReferralCode: referralCode})
+	req, err := http.NewRequest(http.MethodPost, e.server.URL+"/api/user/register", bytes.NewReader(body))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	token := resp.Header.Get("Authorization")
+	if resp.StatusCode == http.StatusOK && token == "" {
+		e.t.Fatalf("register %s: empty token", login)
+	}
+	return resp.StatusCode, token
+}
+
+type orderResponse struct {
+	Number  string  `json:"number"`
+	Status  string  `json:"status"`
+	Accrual float64 `json:"accrual"`
+}
+
+func (e *env) waitOrder(token string, number int64, status string) orderResponse {
+	e.t.Helper()
+
+	want := strconv.FormatInt(number, 10)
+	deadline := time.Now().Add(waitTimeout)
+	var last []orderResponse
+	for time.Now().Before(deadline) {
+		code, body := e.do(http.MethodGet, "/api/user/orders", token, "", "")
+		if code == http.StatusOK {
+			last = nil
+			if err := json.Unmarshal(body, &last); err != nil {
+				e.t.Fatal(err)
+			}
+			for _, o := range last {
+				if o.Number == want && o.Status == status {
+					return o
+				}
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	e.t.Fatalf("order %d did not reach %s, last orders: %+v", number, status, last)
+	return orderResponse{}
+}
+
+func (e *env) balance(token string) map[string]float64 {
+	e.t.Helper()
+
+	code, body := e.do(http.MethodGet, "/api/user/balance", token, "", "")
+	if code != http.StatusOK {
+		e.t.Fatalf("balance: status %d", code)
+	}
+	balance := map[string]float64{}
+	if err := json.Unmarshal(body, &balance); err != nil {
+		e.t.Fatal(err)
+	}
+	return balance
+}
+
+func quickScenario(accrual float64) accrualmock.Scenario {
+	return accrualmock.Scenario{
+		Default: &accrualmock.OrderScript{
+			Steps: []accrualmock.Step{
+				{Status: "REGISTERED"},
+				{Status: "PROCESSED", Accrual: &accrual, After: accrualmock.Duration(200 * time.Millisecond)},
+			},
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package e2e
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/httpserver/middleware/idempotency"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/housekeeping"
+)
+
+func TestIdempotentRetries(t *testing.T) {
+	e := newEnv(t, quickScenario(300))
+	token := e.register("frank")
+
+	for i, want := range []int{http.StatusAccepted, http.StatusAccepted} {
+		code, _ := e.doIdempotent(http.MethodPost, "/api/user/orders", token, "text/plain", "order-1", "12345678903")
+		if code != want {
+			t.Fatalf("add order attempt %d: got %d, want %d", i, code, want)
+		}
+	}
+	e.waitOrder(token, 12345678903, models.StatusProcessed)
+
+	withdraw := `{"order":"2377225624","sum":100}`
+	code, header := e.doIdempotent(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", "withdraw-1", withdraw)
+	if code != http.StatusOK || header.Get(idempotency.HeaderReplayed) != "" {
+		t.Fatalf("withdraw: got %d, replayed %q", code, header.Get(idempotency.HeaderReplayed))
+	}
+	code, header = e.doIdempotent(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", "withdraw-1", withdraw)
+	if code != http.StatusOK || header.Get(idempotency.HeaderReplayed) != "true" {
+		t.Fatalf("withdraw retry: got %d, replayed %q", code, header.Get(idempotency.HeaderReplayed))
+	}
+	if balance := e.balance(token); balance["current"] != 200 || balance["withdrawn"] != 100 {
+		t.Fatalf("balance after retry: got %v", balance)
+	}
+
+	other := `{"order":"79927398713","sum":100}`
+	if code, _ := e.doIdempotent(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", "withdraw-1", other); code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: got %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	purge := housekeeping.PurgeIdempotencyKeys(slog.New(slog.NewTextHandler(io.Discard, nil)), e.store, time.Hour)
+	if err := purge(context.Background(), time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := e.doIdempotent(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", "withdraw-1", withdraw); code != http.StatusConflict {
+		t.Fatalf("withdraw after purge: got %d, want %d", code, http.StatusConflict)
+	}
+}
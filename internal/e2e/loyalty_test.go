@@ -0,0 +1,256 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+func TestLoyaltyTiers(t *testing.T) {
+	e := newEnv(t, quickScenario(600))
+	token := e.register("judy")
+
+	changes := make(chan models.TierChange, 4)
+	e.tier.Subscribe(func(ctx context.Context, change models.TierChange) {
+		changes <- change
+	})
+
+	type profileResponse struct {
+		Tier            string   `json:"tier"`
+		Perks           []string `json:"perks"`
+		LifetimeAccrual float64  `json:"lifetime_accrual"`
+		NextTier        string   `json:"next_tier"`
+		ToNextTier      float64  `json:"to_next_tier"`
+	}
+	profile := func() profileResponse {
+		t.Helper()
+		code, body := e.do(http.MethodGet, "/api/user/profile", token, "", "")
+		if code != http.StatusOK {
+			t.Fatalf("profile: got %d", code)
+		}
+		var p profileResponse
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if p := profile(); p.Tier != "bronze" || p.LifetimeAccrual != 0 || p.NextTier != "silver" || p.ToNextTier != 1000 {
+		t.Fatalf("initial profile: got %+v", p)
+	}
+	if code, _ := e.do(http.MethodGet, "/api/user/profile", "", "", ""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous profile: got %d", code)
+	}
+
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "12345678903"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	e.waitOrder(token, 12345678903, models.StatusProcessed)
+	if p := profile(); p.Tier != "bronze" || p.LifetimeAccrual != 600 || p.ToNextTier != 400 {
+		t.Fatalf("profile after first order: got %+v", p)
+	}
+
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	e.waitOrder(token, 79927398713, models.StatusProcessed)
+
+	select {
+	case change := <-changes:
+		if change.From != "bronze" || change.To != "silver" || change.LifetimeAccrual != 120000 {
+			t.Fatalf("tier change: got %+v", change)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("no tier change event")
+	}
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected tier change: %+v", change)
+	default:
+	}
+
+	p := profile()
+	if p.Tier != "silver" || p.LifetimeAccrual != 1200 || p.NextTier != "gold" || p.ToNextTier != 3800 ||
+		len(p.Perks) != 1 || p.Perks[0] != "priority_support" {
+		t.Fatalf("profile after second order: got %+v", p)
+	}
+}
+
+func TestCampaignBonuses(t *testing.T) {
+	e := newEnv(t, quickScenario(100), func(cfg *config.Config) {
+		cfg.Campaigns.Campaigns = []config.CampaignConfig{
+			{Name: "first-order", Bonus: "50", MaxOrders: 1, Stackable: true},
+			{Name: "double-points", Multiplier: "2", StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour), Stackable: true},
+			{Name: "gold-only", Multiplier: "5", Tiers: []string{"gold"}},
+		}
+	})
+	token := e.register("kate")
+
+	for _, number := range []int64{12345678903, 79927398713} {
+		if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", strconv.FormatInt(number, 10)); code != http.StatusAccepted {
+			t.Fatalf("add order %d: got %d", number, code)
+		}
+		e.waitOrder(token, number, models.StatusProcessed)
+	}
+
+	ctx := context.Background()
+	user, err := e.store.User(ctx, "kate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(waitTimeout)
+	var statement models.LedgerEntryArray
+	for time.Now().Before(deadline) {
+		statement, err = e.store.GetStatement(ctx, user.ID, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statement) == 4 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	bonuses := map[int64]models.LedgerEntry{}
+	for _, entry := range statement {
+		if entry.Kind == models.LedgerKindBonus {
+			bonuses[entry.OrderNum] = entry
+		}
+	}
+	if first := bonuses[12345678903]; first.Amount != 15000 || first.Description != "double-points, first-order" {
+		t.Fatalf("first order bonus: got %+v", first)
+	}
+	if second := bonuses[79927398713]; second.Amount != 10000 || second.Description != "double-points" {
+		t.Fatalf("second order bonus: got %+v", second)
+	}
+
+	code, body := e.do(http.MethodGet, "/api/user/orders", token, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("orders: got %d", code)
+	}
+	var orders []struct {
+		Number  string  `json:"number"`
+		Accrual float64 `json:"accrual"`
+		Bonus   float64 `json:"bonus"`
+	}
+	if err := json.Unmarshal(body, &orders); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range orders {
+		if o.Accrual != 100 || (o.Number == "12345678903" && o.Bonus != 150) || (o.Number == "79927398713" && o.Bonus != 100) {
+			t.Fatalf("orders: got %+v", orders)
+		}
+	}
+	if balance := e.balance(token); balance["current"] != 450 {
+		t.Fatalf("balance: got %v", balance)
+	}
+
+	if p, err := e.tier.Profile(ctx, user.ID); err != nil || p.LifetimeAccrual != 20000 {
+		t.Fatalf("lifetime accrual must exclude bonuses: got %+v, %v", p, err)
+	}
+	drifts, err := e.store.CheckBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
+
+func TestReferrals(t *testing.T) {
+	e := newEnv(t, quickScenario(200), func(cfg *config.Config) {
+		cfg.Referral = config.ReferralConfig{ReferrerBonus: "100", RefereeBonus: "50"}
+	})
+	referrer := e.register("nina")
+
+	type statsResponse struct {
+		Code     string  `json:"code"`
+		Referred int     `json:"referred"`
+		Rewarded int     `json:"rewarded"`
+		Earned   float64 `json:"earned"`
+	}
+	stats := func(token string) statsResponse {
+		t.Helper()
+		code, body := e.do(http.MethodGet, "/api/user/referrals", token, "", "")
+		if code != http.StatusOK {
+			t.Fatalf("referral stats: got %d", code)
+		}
+		var stats statsResponse
+		if err := json.Unmarshal(body, &stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+	code := stats(referrer).Code
+	if code == "" {
+		t.Fatal("referral stats: empty code")
+	}
+
+	if status, _ := e.registerReferred("oleg", "NOPE1234"); status != http.StatusBadRequest {
+		t.Fatalf("register with unknown code: got %d", status)
+	}
+	status, referee := e.registerReferred("oleg", strings.ToLower(code))
+	if status != http.StatusOK {
+		t.Fatalf("register with code: got %d", status)
+	}
+	if got := stats(referrer); got.Referred != 1 || got.Rewarded != 0 {
+		t.Fatalf("referral stats before order: got %+v", got)
+	}
+
+	for _, number := range []int64{12345678903, 79927398713} {
+		if code, _ := e.do(http.MethodPost, "/api/user/orders", referee, "text/plain", strconv.FormatInt(number, 10)); code != http.StatusAccepted {
+			t.Fatalf("add order %d: got %d", number, code)
+		}
+		e.waitOrder(referee, number, models.StatusProcessed)
+	}
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) && stats(referrer).Rewarded == 0 {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := stats(referrer); got.Referred != 1 || got.Rewarded != 1 || got.Earned != 100 {
+		t.Fatalf("referral stats: got %+v", got)
+	}
+	if balance := e.balance(referrer); balance["current"] != 100 {
+		t.Fatalf("referrer balance: got %v", balance)
+	}
+	if balance := e.balance(referee); balance["current"] != 450 {
+		t.Fatalf("referee balance: got %v", balance)
+	}
+
+	ctx := context.Background()
+	user, err := e.store.User(ctx, "oleg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, err := e.store.GetStatement(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rewards int
+	for _, entry := range statement {
+		if entry.Kind == models.LedgerKindReferral {
+			rewards++
+			if entry.OrderNum != 12345678903 || entry.Amount != 5000 {
+				t.Fatalf("referee reward: got %+v", entry)
+			}
+		}
+	}
+	if rewards != 1 {
+		t.Fatalf("referee rewards: got %d", rewards)
+	}
+
+	drifts, err := e.store.CheckBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
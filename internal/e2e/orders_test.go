@@ -0,0 +1,208 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/accrualmock"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+func TestOrderLifecycle(t *testing.T) {
+	e := newEnv(t, quickScenario(500))
+
+	alice := e.register("alice")
+	bob := e.register("bob")
+
+	if code, _ := e.do(http.MethodGet, "/api/user/orders", alice, "", ""); code != http.StatusNoContent {
+		t.Fatalf("empty orders: got %d, want %d", code, http.StatusNoContent)
+	}
+	if got := e.balance(alice); got["current"] != 0 || got["withdrawn"] != 0 {
+		t.Fatalf("empty balance: got %v", got)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{name: "new order", token: alice, body: "12345678903", want: http.StatusAccepted},
+		{name: "same user again", token: alice, body: "12345678903", want: http.StatusOK},
+		{name: "other user", token: bob, body: "12345678903", want: http.StatusConflict},
+		{name: "luhn invalid", token: alice, body: "12345678901", want: http.StatusUnprocessableEntity},
+		{name: "not a number", token: alice, body: "abc", want: http.StatusBadRequest},
+		{name: "unauthorized", token: "", body: "79927398713", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := e.do(http.MethodPost, "/api/user/orders", tt.token, "text/plain", tt.body)
+			if code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	got := e.waitOrder(alice, 12345678903, models.StatusProcessed)
+	if got.Accrual != 500 {
+		t.Fatalf("accrual: got %v, want 500", got.Accrual)
+	}
+	if balance := e.balance(alice); balance["current"] != 500 {
+		t.Fatalf("balance after accrual: got %v", balance)
+	}
+
+	withdraw := `{"order":"2377225624","sum":120.5}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", withdraw); code != http.StatusOK {
+		t.Fatalf("withdraw: got %d, want %d", code, http.StatusOK)
+	}
+	if balance := e.balance(alice); balance["current"] != 379.5 || balance["withdrawn"] != 120.5 {
+		t.Fatalf("balance after withdraw: got %v", balance)
+	}
+	duplicate := `{"order":"2377225624","sum":1}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", duplicate); code != http.StatusConflict {
+		t.Fatalf("duplicate withdraw: got %d, want %d", code, http.StatusConflict)
+	}
+	code, body := e.do(http.MethodGet, "/api/user/orders", alice, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("orders after withdraw: got %d, want %d", code, http.StatusOK)
+	}
+	var orders []orderResponse
+	if err := json.Unmarshal(body, &orders); err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].Number != "12345678903" {
+		t.Fatalf("orders after withdraw: got %+v", orders)
+	}
+
+	tooMuch := `{"order":"79927398713","sum":1000}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", tooMuch); code != http.StatusPaymentRequired {
+		t.Fatalf("withdraw over balance: got %d, want %d", code, http.StatusPaymentRequired)
+	}
+	badNumber := `{"order":"12345678901","sum":1}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", badNumber); code != http.StatusUnprocessableEntity {
+		t.Fatalf("withdraw luhn invalid: got %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	for _, sum := range []string{"-1000", "0"} {
+		notPositive := fmt.Sprintf(`{"order":"79927398713","sum":%s}`, sum)
+		if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", notPositive); code != http.StatusUnprocessableEntity {
+			t.Fatalf("withdraw sum %s: got %d, want %d", sum, code, http.StatusUnprocessableEntity)
+		}
+	}
+	if balance := e.balance(alice); balance["current"] != 379.5 || balance["withdrawn"] != 120.5 {
+		t.Fatalf("balance after rejected withdrawals: got %v", balance)
+	}
+
+	code, body = e.do(http.MethodGet, "/api/user/withdrawals", alice, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("withdrawals: got %d, want %d", code, http.StatusOK)
+	}
+	var withdrawals []struct {
+		Order string  `json:"order"`
+		Sum   float64 `json:"sum"`
+	}
+	if err := json.Unmarshal(body, &withdrawals); err != nil {
+		t.Fatal(err)
+	}
+	if len(withdrawals) != 1 || withdrawals[0].Order != "2377225624" || withdrawals[0].Sum != 120.5 {
+		t.Fatalf("withdrawals: got %+v", withdrawals)
+	}
+	if code, _ := e.do(http.MethodGet, "/api/user/withdrawals", bob, "", ""); code != http.StatusNoContent {
+		t.Fatalf("empty withdrawals: got %d, want %d", code, http.StatusNoContent)
+	}
+
+	code, body = e.do(http.MethodGet, "/api/user/statement", alice, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("statement: got %d, want %d", code, http.StatusOK)
+	}
+	var statement []struct {
+		Kind   string  `json:"kind"`
+		Amount float64 `json:"amount"`
+		Order  string  `json:"order"`
+	}
+	if err := json.Unmarshal(body, &statement); err != nil {
+		t.Fatal(err)
+	}
+	if len(statement) != 2 ||
+		statement[0].Kind != models.LedgerKindWithdrawal || statement[0].Amount != -120.5 || statement[0].Order != "2377225624" ||
+		statement[1].Kind != models.LedgerKindAccrual || statement[1].Amount != 500 || statement[1].Order != "12345678903" {
+		t.Fatalf("statement: got %+v", statement)
+	}
+	if code, _ := e.do(http.MethodGet, "/api/user/statement?limit=1&offset=2", alice, "", ""); code != http.StatusNoContent {
+		t.Fatalf("statement past the end: got %d, want %d", code, http.StatusNoContent)
+	}
+	if code, _ := e.do(http.MethodGet, "/api/user/statement?limit=0", alice, "", ""); code != http.StatusBadRequest {
+		t.Fatalf("statement bad limit: got %d, want %d", code, http.StatusBadRequest)
+	}
+
+	drifts, err := e.store.CheckBalances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
+
+func TestTerminalAccrualOutcomes(t *testing.T) {
+	e := newEnv(t, quickScenario(100))
+	e.mock.SetOrder(346436439, accrualmock.OrderScript{Steps: []accrualmock.Step{{Status: "INVALID"}}})
+	e.mock.SetOrder(9278923470, accrualmock.OrderScript{Unknown: true})
+
+	token := e.register("carol")
+	for _, number := range []string{"346436439", "9278923470"} {
+		if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", number); code != http.StatusAccepted {
+			t.Fatalf("add order %s: got %d", number, code)
+		}
+	}
+
+	e.waitOrder(token, 346436439, models.StatusInvalid)
+	e.waitOrder(token, 9278923470, models.StatusInvalid)
+	if balance := e.balance(token); balance["current"] != 0 {
+		t.Fatalf("balance: got %v", balance)
+	}
+}
+
+func TestThrottledAccrualRecovers(t *testing.T) {
+	e := newEnv(t, quickScenario(50))
+	e.mock.SetThrottle(&accrualmock.Throttle{RequestsPerMinute: 1, RetryAfter: accrualmock.Duration(time.Second)})
+
+	token := e.register("dave")
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "4561261212345467"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	time.Sleep(time.Second)
+	e.mock.SetThrottle(nil)
+
+	e.waitOrder(token, 4561261212345467, models.StatusProcessed)
+}
+
+func TestFailingOrderIsDeadLettered(t *testing.T) {
+	e := newEnv(t, quickScenario(10))
+	e.mock.SetOrder(79927398713, accrualmock.OrderScript{FailFirst: 1000})
+
+	token := e.register("erin")
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		order, err := e.store.GetDeadLetterOrder(context.Background(), 79927398713)
+		if err == nil {
+			if order.Failures != 3 || order.LastError == "" {
+				t.Fatalf("dead letter: got %+v", order)
+			}
+			return
+		}
+		if !errors.Is(err, models.ErrDeadLetterNotFound) {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("order was not dead-lettered")
+}
@@ -0,0 +1,189 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/housekeeping"
+	"github.com/ArtShib/gophermart.git/internal/services/order"
+)
+
+func TestPointsExpiration(t *testing.T) {
+	e := newEnv(t, quickScenario(500))
+	token := e.register("ivan")
+
+	for _, number := range []int64{12345678903, 79927398713} {
+		if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", strconv.FormatInt(number, 10)); code != http.StatusAccepted {
+			t.Fatalf("add order %d: got %d", number, code)
+		}
+		e.waitOrder(token, number, models.StatusProcessed)
+	}
+	withdraw := `{"order":"2377225624","sum":200}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", withdraw); code != http.StatusOK {
+		t.Fatalf("withdraw: got %d", code)
+	}
+
+	ctx := context.Background()
+	user, err := e.store.User(ctx, "ivan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	later := now.AddDate(0, 0, 40)
+	if err := e.store.AddAdjustment(ctx, user.ID, 10000, "goodwill", later.Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.PointsConfig{LifetimeMonths: config.DefaultPointsLifetimeMonths, ExpiringWindow: 450 * 24 * time.Hour}
+	svc := order.New(slog.New(slog.NewTextHandler(io.Discard, nil)), e.store, cfg)
+	balance, err := svc.Balance(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(balance.Expiring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`[{"date":"%s","amount":800},{"date":"%s","amount":100}]`,
+		now.UTC().AddDate(0, 12, 0).Format(time.DateOnly), later.UTC().AddDate(0, 12, 0).Format(time.DateOnly))
+	if string(body) != want {
+		t.Fatalf("expiring points: got %s, want %s", body, want)
+	}
+
+	reserve := `{"order":"4561261212345467","sum":100}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/reservations", token, "application/json", reserve); code != http.StatusCreated {
+		t.Fatalf("reserve: got %d", code)
+	}
+
+	janitor := housekeeping.ExpirePoints(slog.New(slog.NewTextHandler(io.Discard, nil)), e.store)
+	if err := janitor(ctx, now.AddDate(0, 12, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if balance := e.balance(token); balance["current"] != 0 || balance["withdrawn"] != 200 || balance["reserved"] != 100 {
+		t.Fatalf("balance after expiry: got %v", balance)
+	}
+	if expired, err := e.store.ExpirePoints(ctx, now.AddDate(0, 12, 1).Unix()); err != nil || expired != 0 {
+		t.Fatalf("repeated expiry: got %s, %v", expired, err)
+	}
+
+	statement, err := e.store.GetStatement(ctx, user.ID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement[0].Kind != models.LedgerKindExpiration || statement[0].Amount != -80000 {
+		t.Fatalf("expiry posting: got %+v", statement[0])
+	}
+
+	drifts, err := e.store.CheckBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
+
+func TestPointTransfers(t *testing.T) {
+	e := newEnv(t, quickScenario(500), func(cfg *config.Config) {
+		cfg.Transfer.DailyCount = 2
+	})
+	sender := e.register("lena")
+	recipient := e.register("mike")
+
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", sender, "text/plain", "12345678903"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	e.waitOrder(sender, 12345678903, models.StatusProcessed)
+
+	send := func(to string, sum string) (int, []byte) {
+		t.Helper()
+		return e.do(http.MethodPost, "/api/user/balance/transfer", sender, "application/json",
+			fmt.Sprintf(`{"to":%q,"sum":%s}`, to, sum))
+	}
+	rejected := []struct {
+		to, sum string
+		want    int
+	}{
+		{"nobody", "10", http.StatusNotFound},
+		{"lena", "10", http.StatusBadRequest},
+		{"mike", "0", http.StatusBadRequest},
+		{"mike", "500", http.StatusPaymentRequired},
+	}
+	for _, tt := range rejected {
+		if code, _ := send(tt.to, tt.sum); code != tt.want {
+			t.Fatalf("transfer %s to %s: got %d, want %d", tt.sum, tt.to, code, tt.want)
+		}
+	}
+
+	code, body := send("mike", "100")
+	if code != http.StatusOK {
+		t.Fatalf("transfer: got %d", code)
+	}
+	type transferResponse struct {
+		Direction    string  `json:"direction"`
+		Counterparty string  `json:"counterparty"`
+		Sum          float64 `json:"sum"`
+	}
+	var sent transferResponse
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Direction != models.TransferOut || sent.Counterparty != "mike" || sent.Sum != 100 {
+		t.Fatalf("transfer response: got %+v", sent)
+	}
+	if code, _ := send("mike", "50.5"); code != http.StatusOK {
+		t.Fatalf("second transfer: got %d", code)
+	}
+	if code, _ := send("mike", "1"); code != http.StatusTooManyRequests {
+		t.Fatalf("transfer over daily count: got %d", code)
+	}
+
+	if balance := e.balance(sender); balance["current"] != 349.5 || balance["withdrawn"] != 0 {
+		t.Fatalf("sender balance: got %v", balance)
+	}
+	if balance := e.balance(recipient); balance["current"] != 150.5 {
+		t.Fatalf("recipient balance: got %v", balance)
+	}
+
+	code, body = e.do(http.MethodGet, "/api/user/transfers", recipient, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("recipient transfers: got %d", code)
+	}
+	var received []transferResponse
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].Direction != models.TransferIn || received[0].Counterparty != "lena" || received[0].Sum != 50.5 {
+		t.Fatalf("recipient transfers: got %+v", received)
+	}
+
+	ctx := context.Background()
+	user, err := e.store.User(ctx, "mike")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, err := e.store.GetStatement(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statement) != 2 || statement[0].Kind != models.LedgerKindTransfer || statement[0].Amount != 5050 {
+		t.Fatalf("recipient statement: got %+v", statement)
+	}
+
+	drifts, err := e.store.CheckBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
@@ -0,0 +1,169 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/refund"
+)
+
+func TestWithdrawalReservations(t *testing.T) {
+	e := newEnv(t, quickScenario(500))
+	token := e.register("grace")
+
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "12345678903"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	e.waitOrder(token, 12345678903, models.StatusProcessed)
+
+	reserve := func(number string, sum int) int {
+		body := fmt.Sprintf(`{"order":%q,"sum":%d}`, number, sum)
+		code, _ := e.do(http.MethodPost, "/api/user/balance/reservations", token, "application/json", body)
+		return code
+	}
+	resolve := func(number, action string) int {
+		code, _ := e.do(http.MethodPost, "/api/user/balance/reservations/"+number+"/"+action, token, "", "")
+		return code
+	}
+
+	if code := reserve("2377225624", 100); code != http.StatusCreated {
+		t.Fatalf("reserve: got %d, want %d", code, http.StatusCreated)
+	}
+	if code := reserve("2377225624", 10); code != http.StatusConflict {
+		t.Fatalf("reserve same number: got %d, want %d", code, http.StatusConflict)
+	}
+	if balance := e.balance(token); balance["current"] != 400 || balance["reserved"] != 100 || balance["withdrawn"] != 0 {
+		t.Fatalf("balance after reserve: got %v", balance)
+	}
+	tooMuch := `{"order":"79927398713","sum":450}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", tooMuch); code != http.StatusPaymentRequired {
+		t.Fatalf("withdraw reserved points: got %d, want %d", code, http.StatusPaymentRequired)
+	}
+
+	if code := resolve("2377225624", "confirm"); code != http.StatusOK {
+		t.Fatalf("confirm: got %d, want %d", code, http.StatusOK)
+	}
+	if code := resolve("2377225624", "confirm"); code != http.StatusConflict {
+		t.Fatalf("confirm twice: got %d, want %d", code, http.StatusConflict)
+	}
+	if balance := e.balance(token); balance["current"] != 400 || balance["reserved"] != 0 || balance["withdrawn"] != 100 {
+		t.Fatalf("balance after confirm: got %v", balance)
+	}
+
+	if code := reserve("79927398713", 50); code != http.StatusCreated {
+		t.Fatalf("reserve to cancel: got %d", code)
+	}
+	if code := resolve("79927398713", "cancel"); code != http.StatusOK {
+		t.Fatalf("cancel: got %d, want %d", code, http.StatusOK)
+	}
+	if code := resolve("1234567812345670", "cancel"); code != http.StatusNotFound {
+		t.Fatalf("cancel unknown: got %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := reserve("4561261212345467", 50); code != http.StatusCreated {
+		t.Fatalf("reserve to expire: got %d", code)
+	}
+	expired, err := e.store.ExpireReservations(context.Background(), time.Now().Add(2*time.Minute).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("expired reservations: got %d, want 1", expired)
+	}
+	if code := resolve("4561261212345467", "confirm"); code != http.StatusGone {
+		t.Fatalf("confirm expired: got %d, want %d", code, http.StatusGone)
+	}
+	if balance := e.balance(token); balance["current"] != 400 || balance["reserved"] != 0 {
+		t.Fatalf("balance after expiry: got %v", balance)
+	}
+
+	drifts, err := e.store.CheckBalances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
+
+func TestWithdrawalReversal(t *testing.T) {
+	e := newEnv(t, quickScenario(500))
+	token := e.register("heidi")
+
+	if code, _ := e.do(http.MethodPost, "/api/user/orders", token, "text/plain", "12345678903"); code != http.StatusAccepted {
+		t.Fatalf("add order: got %d", code)
+	}
+	e.waitOrder(token, 12345678903, models.StatusProcessed)
+	withdraw := `{"order":"2377225624","sum":200}`
+	if code, _ := e.do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", withdraw); code != http.StatusOK {
+		t.Fatalf("withdraw: got %d", code)
+	}
+
+	svc := refund.New(slog.New(slog.NewTextHandler(io.Discard, nil)), e.store)
+	ctx := context.Background()
+	if _, err := svc.Reverse(ctx, 2377225624, 0, "", ""); !errors.Is(err, models.ErrReversalUnattributed) {
+		t.Fatalf("unattributed reversal: got %v", err)
+	}
+	if _, err := svc.Reverse(ctx, 79927398713, 0, "support", "refund"); !errors.Is(err, models.ErrWithdrawalNotFound) {
+		t.Fatalf("unknown withdrawal: got %v", err)
+	}
+	if _, err := svc.Reverse(ctx, 2377225624, 25000, "support", "refund"); !errors.Is(err, models.ErrReversalTooLarge) {
+		t.Fatalf("oversized reversal: got %v", err)
+	}
+
+	if _, err := svc.Reverse(ctx, 2377225624, 5000, "support", "partial refund"); err != nil {
+		t.Fatal(err)
+	}
+	if balance := e.balance(token); balance["current"] != 350 || balance["withdrawn"] != 150 {
+		t.Fatalf("balance after partial reversal: got %v", balance)
+	}
+	reversal, err := svc.Reverse(ctx, 2377225624, 0, "support", "order cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal.Sum != -15000 {
+		t.Fatalf("full reversal sum: got %s, want -150", reversal.Sum)
+	}
+	if _, err := svc.Reverse(ctx, 2377225624, 0, "support", "again"); !errors.Is(err, models.ErrReversalTooLarge) {
+		t.Fatalf("reversal of reversed withdrawal: got %v", err)
+	}
+	if balance := e.balance(token); balance["current"] != 500 || balance["withdrawn"] != 0 {
+		t.Fatalf("balance after full reversal: got %v", balance)
+	}
+
+	code, body := e.do(http.MethodGet, "/api/user/withdrawals", token, "", "")
+	if code != http.StatusOK {
+		t.Fatalf("withdrawals: got %d", code)
+	}
+	var withdrawals []struct {
+		ID         int64   `json:"id"`
+		Order      string  `json:"order"`
+		Sum        float64 `json:"sum"`
+		ReversalOf int64   `json:"reversal_of"`
+		Reason     string  `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &withdrawals); err != nil {
+		t.Fatal(err)
+	}
+	if len(withdrawals) != 3 || withdrawals[0].Sum != 200 ||
+		withdrawals[1].Sum != -50 || withdrawals[1].ReversalOf != withdrawals[0].ID || withdrawals[1].Reason != "partial refund" ||
+		withdrawals[2].Sum != -150 || withdrawals[2].ReversalOf != withdrawals[0].ID {
+		t.Fatalf("withdrawals: got %+v", withdrawals)
+	}
+
+	drifts, err := e.store.CheckBalances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
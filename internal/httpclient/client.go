@@ -4,20 +4,30 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ArtShib/gophermart.git/internal/models"
 )
 
+const defaultRetryAfter = 60 * time.Second
+
+var quotaPattern = regexp.MustCompile(`(?i)no more than (\d+) requests per minute`)
+
 type Client struct {
 	log        *slog.Logger
 	httpClient *http.Client
+	timeout    time.Duration
 }
 
-func New(log *slog.Logger) *Client {
+func New(log *slog.Logger, timeout time.Duration) *Client {
 	return &Client{
+		timeout: timeout,
 		httpClient: &http.Client{
 			Timeout: time.Second * 10,
 			Transport: &http.Transport{
@@ -41,7 +51,7 @@ func (c *Client) RequestAccrualOrder(ctx context.Context, urlConnect string) (*m
 
 	log.Info("request urlConnect")
 
-	nCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	nCtx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 	request, err := http.NewRequestWithContext(nCtx, http.MethodGet, urlConnect, nil)
 	if err != nil {
@@ -50,18 +60,36 @@ func (c *Client) RequestAccrualOrder(ctx context.Context, urlConnect string) (*m
 
 	resp, err := c.httpClient.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s: invalid status code: %d", op, resp.StatusCode)
+		return nil, fmt.Errorf("%s: %w: %w", op, models.ErrAccrualUnavailable, err)
 	}
-	resAccrualOrder := models.ResAccrualOrder{}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
 			c.log.Error(op, "error", err)
 		}
 	}()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		message := strings.TrimSpace(string(body))
+		return nil, fmt.Errorf("%s: %w", op, &models.RateLimitError{
+			RetryAfter:        parseRetryAfter(resp.Header.Get("Retry-After")),
+			RequestsPerMinute: parseQuota(message),
+			Message:           message,
+		})
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrOrderNotRegistered)
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%s: %w: status code: %d", op, models.ErrAccrualUnavailable, resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: invalid status code: %d", op, resp.StatusCode)
+	}
+	resAccrualOrder := models.ResAccrualOrder{}
 	decoder := json.NewDecoder(resp.Body)
 	if err = decoder.Decode(&resAccrualOrder); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -69,3 +97,32 @@ func (c *Client) RequestAccrualOrder(ctx context.Context, urlConnect string) (*m
 
 	return &resAccrualOrder, nil
 }
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+func parseQuota(message string) int {
+	match := quotaPattern.FindStringSubmatch(message)
+	if match == nil {
+		return 0
+	}
+	quota, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return quota
+}
@@ -0,0 +1,122 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: defaultRetryAfter},
+		{value: "0", want: 0},
+		{value: " 30 ", want: 30 * time.Second},
+		{value: "-5", want: defaultRetryAfter},
+		{value: "soon", want: defaultRetryAfter},
+		{value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q): got %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got <= 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q): got %s, want about an hour", future, got)
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		message string
+		want    int
+	}{
+		{message: "No more than 60 requests per minute allowed", want: 60},
+		{message: "no more than 5 REQUESTS PER MINUTE", want: 5},
+		{message: "Too Many Requests", want: 0},
+		{message: "", want: 0},
+		{message: "no more than 99999999999999999999 requests per minute", want: 0},
+	}
+	for _, tt := range tests {
+		if got := parseQuota(tt.message); got != tt.want {
+			t.Errorf("parseQuota(%q): got %d, want %d", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestRequestAccrualOrderMapsStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		want    *models.ResAccrualOrder
+		wantErr error
+	}{
+		{
+			name:   "processed",
+			status: http.StatusOK,
+			body:   `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`,
+			want:   &models.ResAccrualOrder{OrderNum: 12345678903, Status: models.StatusProcessed, Accrual: 72998},
+		},
+		{name: "not registered", status: http.StatusNoContent, wantErr: models.ErrOrderNotRegistered},
+		{name: "server error", status: http.StatusBadGateway, wantErr: models.ErrAccrualUnavailable},
+		{name: "bad request", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			got, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second).RequestAccrualOrder(context.Background(), server.URL)
+			if tt.want != nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *got != *tt.want {
+					t.Fatalf("order: got %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("want error, got %+v", got)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestAccrualOrderReportsRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, "No more than 42 requests per minute allowed\n")
+	}))
+	defer server.Close()
+
+	_, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second).RequestAccrualOrder(context.Background(), server.URL)
+	var limited *models.RateLimitError
+	if !errors.As(err, &limited) {
+		t.Fatalf("error: got %v, want RateLimitError", err)
+	}
+	if limited.RetryAfter != 7*time.Second || limited.RequestsPerMinute != 42 ||
+		limited.Message != "No more than 42 requests per minute allowed" {
+		t.Fatalf("rate limit: got %+v", limited)
+	}
+}
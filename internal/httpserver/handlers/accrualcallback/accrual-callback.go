@@ -0,0 +1,121 @@
+package accrualcallback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/lib/signature"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	SignatureHeader = "X-Accrual-Signature"
+	TimestampHeader = "X-Accrual-Timestamp"
+	Tolerance       = 5 * time.Minute
+	maxBodySize     = 1 << 20
+)
+
+type Accrual interface {
+	Push(ctx context.Context, orders models.ResAccrualOrderArray) error
+}
+
+// Replays remembers accepted signatures until their timestamp leaves the
+// tolerance window. It is shared storage, so a callback replayed to another
+// replica is caught too.
+type Replays interface {
+	RememberCallbackSignature(ctx context.Context, signature string, expiresAt int64) (bool, error)
+}
+
+// Payload is what the sender signs: the timestamp header, a dot and the body.
+func Payload(timestamp string, body []byte) []byte {
+	return append([]byte(timestamp+"."), body...)
+}
+
+func New(log *slog.Logger, accrual Accrual, replays Replays, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Accrual.Callback"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		timestamp := r.Header.Get(TimestampHeader)
+		sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(sentAt, 0)).Abs() > Tolerance {
+			log.Error("invalid callback timestamp", "timestamp", timestamp)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		payload := Payload(timestamp, body)
+		if !signature.Valid(payload, []byte(cfg.CallbackSecret), r.Header.Get(SignatureHeader)) {
+			log.Error("invalid callback signature")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		fresh, err := replays.RememberCallbackSignature(r.Context(), signature.Sign(payload, []byte(cfg.CallbackSecret)), time.Unix(sentAt, 0).Add(Tolerance).Unix())
+		if err != nil {
+			log.Error("failed to remember callback signature", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !fresh {
+			log.Error("replayed callback")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		orders, err := decodeOrders(body)
+		if err != nil {
+			log.Error("failed Unmarshal", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if err := accrual.Push(r.Context(), orders); err != nil {
+			if errors.Is(err, models.ErrUnknownAccrualStatus) {
+				log.Error("failed push accrual", "error", err)
+				http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+				return
+			}
+			log.Error("failed push accrual", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func decodeOrders(body []byte) (models.ResAccrualOrderArray, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var orders models.ResAccrualOrderArray
+		if err := json.Unmarshal(body, &orders); err != nil {
+			return nil, err
+		}
+		return orders, nil
+	}
+	var order models.ResAccrualOrder
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, err
+	}
+	return models.ResAccrualOrderArray{&order}, nil
+}
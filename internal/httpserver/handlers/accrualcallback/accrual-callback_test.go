@@ -0,0 +1,179 @@
+package accrualcallback
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/lib/signature"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/storage/memory"
+)
+
+const secret = "callback-secret"
+
+type recordingAccrual struct {
+	pushed models.ResAccrualOrderArray
+	err    error
+}
+
+func (a *recordingAccrual) Push(ctx context.Context, orders models.ResAccrualOrderArray) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.pushed = append(a.pushed, orders...)
+	return nil
+}
+
+func newHandler(accrual Accrual) http.HandlerFunc {
+	return newReplicaHandler(accrual, memory.NewMemoryStore(0))
+}
+
+func newReplicaHandler(accrual Accrual, replays Replays) http.HandlerFunc {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(log, accrual, replays, &config.Config{CallbackSecret: secret})
+}
+
+func callback(handler http.HandlerFunc, body string, headers map[string]string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/internal/accrual/callback", strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code
+}
+
+func signed(body string, sentAt time.Time) map[string]string {
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	return map[string]string{
+		TimestampHeader: timestamp,
+		SignatureHeader: signature.Sign(Payload(timestamp, []byte(body)), []byte(secret)),
+	}
+}
+
+func TestCallbackAcceptsValidSignature(t *testing.T) {
+	accrual := &recordingAccrual{}
+	handler := newHandler(accrual)
+
+	body := `[{"order":"12345678903","status":"PROCESSED","accrual":500},{"order":"79927398713","status":"REGISTERED"}]`
+	if code := callback(handler, body, signed(body, time.Now())); code != http.StatusAccepted {
+		t.Fatalf("valid batch: got %d", code)
+	}
+	single := `{"order":"4561261212345467","status":"INVALID"}`
+	if code := callback(handler, single, signed(single, time.Now())); code != http.StatusAccepted {
+		t.Fatalf("valid single order: got %d", code)
+	}
+	if len(accrual.pushed) != 3 || accrual.pushed[0].OrderNum != 12345678903 || accrual.pushed[0].Accrual != 50000 {
+		t.Fatalf("pushed: got %+v", accrual.pushed)
+	}
+}
+
+func TestCallbackRejectsUnsignedRequests(t *testing.T) {
+	body := `{"order":"12345678903","status":"PROCESSED","accrual":500}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	valid := signed(body, time.Now())
+
+	tests := []struct {
+		name    string
+		body    string
+		headers map[string]string
+	}{
+		{name: "missing headers", body: body},
+		{name: "missing signature", body: body, headers: map[string]string{TimestampHeader: now}},
+		{name: "missing timestamp", body: body, headers: map[string]string{SignatureHeader: valid[SignatureHeader]}},
+		{name: "wrong secret", body: body, headers: map[string]string{
+			TimestampHeader: now,
+			SignatureHeader: signature.Sign(Payload(now, []byte(body)), []byte("other")),
+		}},
+		{name: "body signed without timestamp", body: body, headers: map[string]string{
+			TimestampHeader: now,
+			SignatureHeader: signature.Sign([]byte(body), []byte(secret)),
+		}},
+		{name: "tampered body", body: strings.Replace(body, "500", "5000", 1), headers: valid},
+		{name: "malformed signature", body: body, headers: map[string]string{TimestampHeader: now, SignatureHeader: "sha256=zz"}},
+		{name: "stale timestamp", body: body, headers: signed(body, time.Now().Add(-2*Tolerance))},
+		{name: "future timestamp", body: body, headers: signed(body, time.Now().Add(2*Tolerance))},
+	}
+	for _, tt := range tests {
+		accrual := &recordingAccrual{}
+		if code := callback(newHandler(accrual), tt.body, tt.headers); code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d, want %d", tt.name, code, http.StatusUnauthorized)
+		}
+		if len(accrual.pushed) != 0 {
+			t.Errorf("%s: pushed %+v", tt.name, accrual.pushed)
+		}
+	}
+}
+
+func TestCallbackRejectsReplayedBody(t *testing.T) {
+	accrual := &recordingAccrual{}
+	handler := newHandler(accrual)
+
+	body := `{"order":"12345678903","status":"PROCESSED","accrual":500}`
+	headers := signed(body, time.Now())
+	if code := callback(handler, body, headers); code != http.StatusAccepted {
+		t.Fatalf("first delivery: got %d", code)
+	}
+	if code := callback(handler, body, headers); code != http.StatusUnauthorized {
+		t.Fatalf("replay: got %d", code)
+	}
+	upper := map[string]string{
+		TimestampHeader: headers[TimestampHeader],
+		SignatureHeader: "SHA256=" + strings.ToUpper(strings.TrimPrefix(headers[SignatureHeader], "sha256=")),
+	}
+	if code := callback(handler, body, upper); code != http.StatusUnauthorized {
+		t.Fatalf("replay with reformatted signature: got %d", code)
+	}
+	resent := signed(body, time.Now().Add(time.Second))
+	if code := callback(handler, body, resent); code != http.StatusAccepted {
+		t.Fatalf("re-signed delivery: got %d", code)
+	}
+	if len(accrual.pushed) != 2 {
+		t.Fatalf("pushed: got %+v", accrual.pushed)
+	}
+}
+
+func TestCallbackRejectsReplayToAnotherReplica(t *testing.T) {
+	store := memory.NewMemoryStore(0)
+	first, second := &recordingAccrual{}, &recordingAccrual{}
+
+	body := `{"order":"12345678903","status":"PROCESSED","accrual":500}`
+	headers := signed(body, time.Now())
+	if code := callback(newReplicaHandler(first, store), body, headers); code != http.StatusAccepted {
+		t.Fatalf("first replica: got %d", code)
+	}
+	if code := callback(newReplicaHandler(second, store), body, headers); code != http.StatusUnauthorized {
+		t.Fatalf("replay to second replica: got %d", code)
+	}
+	if len(second.pushed) != 0 {
+		t.Fatalf("second replica pushed: got %+v", second.pushed)
+	}
+}
+
+func TestCallbackRejectsBadPayloads(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{name: "malformed json", body: `{"order":`, want: http.StatusBadRequest},
+		{name: "unknown status", body: `{"order":"12345678903","status":"LOST"}`, err: fmt.Errorf("push: %w", models.ErrUnknownAccrualStatus), want: http.StatusUnprocessableEntity},
+		{name: "push failure", body: `{"order":"12345678903","status":"PROCESSED"}`, err: context.DeadlineExceeded, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		handler := newHandler(&recordingAccrual{err: tt.err})
+		if code := callback(handler, tt.body, signed(tt.body, time.Now())); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
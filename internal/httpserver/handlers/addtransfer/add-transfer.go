@@ -0,0 +1,85 @@
+package addtransfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Transfer interface {
+	Send(ctx context.Context, fromUserID int64, toLogin string, sum models.Money) (*models.UserTransfer, error)
+}
+
+func New(log *slog.Logger, transfer Transfer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Transfer.Send"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		contentType := r.Header.Get("Content-Type")
+		if contentType != "application/json" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var requestTransfer models.RequestTransfer
+
+		err := json.NewDecoder(r.Body).Decode(&requestTransfer)
+		if err != nil || requestTransfer.To == "" || requestTransfer.Sum <= 0 {
+			log.Error("failed Unmarshal", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sent, err := transfer.Send(r.Context(), userID, requestTransfer.To, requestTransfer.Sum)
+		if err != nil {
+			if errors.Is(err, models.ErrUserNotFound) {
+				log.Error("recipient not found", "error", models.ErrUserNotFound)
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, models.ErrTransferToSelf) || errors.Is(err, models.ErrInvalidTransfer) {
+				log.Error("invalid transfer", "error", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, models.ErrWithdrawBalanceUser) {
+				log.Error("there are not enough bonuses to transfer", "error", models.ErrWithdrawBalanceUser)
+				http.Error(w, http.StatusText(http.StatusPaymentRequired), http.StatusPaymentRequired)
+				return
+			}
+			if errors.Is(err, models.ErrTransferLimit) {
+				log.Error("daily transfer limit exceeded", "error", models.ErrTransferLimit)
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			log.Error("failed transfer", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(sent); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 type Order interface {
-	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64) error
+	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) error
 }
 
 func New(log *slog.Logger, order Order) http.HandlerFunc {
@@ -47,8 +47,14 @@ func New(log *slog.Logger, order Order) http.HandlerFunc {
 			return
 		}
 
+		if requestWithdraw.Sum <= 0 {
+			log.Error("failed add withdrawal", "error", models.ErrInvalidWithdrawSum)
+			http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+			return
+		}
+
 		if err := order.AddWithdraw(r.Context(), requestWithdraw.Order, userID, requestWithdraw.Sum); err != nil {
-			if errors.Is(err, models.ErrNotValidOrderNumber) {
+			if errors.Is(err, models.ErrNotValidOrderNumber) || errors.Is(err, models.ErrInvalidWithdrawSum) {
 				log.Error("failed add order", "error", models.ErrNotValidOrderNumber)
 				http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
 				return
@@ -58,6 +64,11 @@ func New(log *slog.Logger, order Order) http.HandlerFunc {
 				http.Error(w, http.StatusText(http.StatusPaymentRequired), http.StatusPaymentRequired)
 				return
 			}
+			if errors.Is(err, models.ErrWithdrawalExists) {
+				log.Error("withdrawal already exists", "error", models.ErrWithdrawalExists)
+				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+				return
+			}
 			log.Error("failed add order", "error", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
@@ -0,0 +1,64 @@
+package confirmwithdraw
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Order interface {
+	ConfirmWithdraw(ctx context.Context, numOrder int64, userID int64) error
+}
+
+func New(log *slog.Logger, order Order) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Order.ConfirmWithdraw"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		orderNumber, err := strconv.ParseInt(chi.URLParam(r, "number"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid order number", http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := order.ConfirmWithdraw(r.Context(), orderNumber, userID); err != nil {
+			switch {
+			case errors.Is(err, models.ErrReservationNotFound):
+				log.Error("failed confirm withdrawal", "error", models.ErrReservationNotFound)
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			case errors.Is(err, models.ErrReservationClosed):
+				log.Error("failed confirm withdrawal", "error", models.ErrReservationClosed)
+				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			case errors.Is(err, models.ErrReservationExpired):
+				log.Error("failed confirm withdrawal", "error", models.ErrReservationExpired)
+				http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+			case errors.Is(err, models.ErrWithdrawBalanceUser):
+				log.Error("there are not enough bonuses to deduct", "error", models.ErrWithdrawBalanceUser)
+				http.Error(w, http.StatusText(http.StatusPaymentRequired), http.StatusPaymentRequired)
+			default:
+				log.Error("failed confirm withdrawal", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,47 @@
+package getprofile
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Tier interface {
+	Profile(ctx context.Context, userID int64) (*models.Profile, error)
+}
+
+func New(log *slog.Logger, tier Tier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Profile.Get"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		profile, err := tier.Profile(r.Context(), userID)
+		if err != nil {
+			log.Error("get profile", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(profile); err != nil {
+			log.Error("encode profile", "error", err)
+		}
+	}
+}
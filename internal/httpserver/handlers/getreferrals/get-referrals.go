@@ -0,0 +1,49 @@
+package getreferrals
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Referral interface {
+	Stats(ctx context.Context, userID int64) (*models.ReferralStats, error)
+}
+
+func New(log *slog.Logger, referral Referral) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Referral.Stats"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		stats, err := referral.Stats(r.Context(), userID)
+		if err != nil {
+			log.Error("get referral stats", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(stats); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package getstatement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type Order interface {
+	Statement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error)
+}
+
+func New(log *slog.Logger, order Order) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Statement.Get"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit, err := queryInt(r, "limit", defaultLimit)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+
+		statement, err := order.Statement(r.Context(), userID, limit, offset)
+		if err != nil {
+			if errors.Is(err, models.ErrStatementEmpty) {
+				log.Info("statement is empty")
+				http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+				return
+			}
+			log.Error("get statement", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(statement); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,54 @@
+package gettransfers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Transfer interface {
+	History(ctx context.Context, userID int64) (models.UserTransferArray, error)
+}
+
+func New(log *slog.Logger, transfer Transfer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Transfer.History"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		transfers, err := transfer.History(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, models.ErrTransfersEmpty) {
+				http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
+				return
+			}
+			log.Error("get transfers", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(transfers); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package poolstats
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Pool interface {
+	Stats() models.PoolStats
+}
+
+func New(log *slog.Logger, pool Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Pool.Stats"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(pool.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
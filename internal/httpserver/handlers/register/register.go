@@ -13,7 +13,7 @@ import (
 )
 
 type AuthRegister interface {
-	RegisterNewUser(ctx context.Context, login string, pass string, secretKey []byte) (string, error)
+	RegisterNewUser(ctx context.Context, login string, pass string, referralCode string, secretKey []byte) (string, error)
 }
 
 func New(log *slog.Logger, authRegister AuthRegister, cfg *config.Config) http.HandlerFunc {
@@ -40,13 +40,18 @@ func New(log *slog.Logger, authRegister AuthRegister, cfg *config.Config) http.H
 			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 			return
 		}
-		token, err := authRegister.RegisterNewUser(r.Context(), requestUser.Login, requestUser.Password, cfg.SecretKey)
+		token, err := authRegister.RegisterNewUser(r.Context(), requestUser.Login, requestUser.Password, requestUser.ReferralCode, cfg.SecretKey)
 		if err != nil {
 			if errors.Is(err, models.ErrUserExists) {
 				log.Error("failed RegisterNewUser", "error", err)
 				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
 				return
 			}
+			if errors.Is(err, models.ErrInvalidReferralCode) {
+				log.Error("failed RegisterNewUser", "error", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
 			log.Error("failed RegisterNewUser", "error", err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
@@ -0,0 +1,80 @@
+package reservewithdraw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Order interface {
+	ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) (*models.Reservation, error)
+}
+
+func New(log *slog.Logger, order Order) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Order.ReserveWithdraw"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		contentType := r.Header.Get("Content-Type")
+		if contentType != "application/json" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		var requestWithdraw models.RequestWithdraw
+
+		err := json.NewDecoder(r.Body).Decode(&requestWithdraw)
+		if err != nil || requestWithdraw.Sum <= 0 {
+			log.Error("failed Unmarshal", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := r.Context().Value(models.UserIDKey).(int64)
+		if !ok || userID == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		reservation, err := order.ReserveWithdraw(r.Context(), requestWithdraw.Order, userID, requestWithdraw.Sum)
+		if err != nil {
+			if errors.Is(err, models.ErrNotValidOrderNumber) {
+				log.Error("failed reserve withdrawal", "error", models.ErrNotValidOrderNumber)
+				http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+				return
+			}
+			if errors.Is(err, models.ErrWithdrawBalanceUser) {
+				log.Error("there are not enough bonuses to reserve", "error", models.ErrWithdrawBalanceUser)
+				http.Error(w, http.StatusText(http.StatusPaymentRequired), http.StatusPaymentRequired)
+				return
+			}
+			if errors.Is(err, models.ErrWithdrawalExists) {
+				log.Error("withdrawal already exists", "error", models.ErrWithdrawalExists)
+				http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+				return
+			}
+			log.Error("failed reserve withdrawal", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(reservation); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package reversewithdrawal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+type Refund interface {
+	Reverse(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string) (*models.Withdrawals, error)
+}
+
+func New(log *slog.Logger, refund Refund) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "Refund.Reverse"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		log.Info("received request")
+
+		operator, ok := r.Context().Value(models.OperatorKey).(string)
+		if !ok || operator == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		orderNumber, err := strconv.ParseInt(chi.URLParam(r, "number"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid order number", http.StatusBadRequest)
+			return
+		}
+
+		var request models.RequestReversal
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Error("failed Unmarshal", "error", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		reversal, err := refund.Reverse(r.Context(), orderNumber, request.Sum, operator, request.Reason)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidReversal), errors.Is(err, models.ErrReversalUnattributed):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, models.ErrWithdrawalNotFound):
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			case errors.Is(err, models.ErrReversalTooLarge):
+				http.Error(w, models.ErrReversalTooLarge.Error(), http.StatusConflict)
+			default:
+				log.Error("failed reverse withdrawal", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(reversal); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package adminauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+const bearerPrefix = "Bearer "
+
+// New authenticates admin requests by bearer token and stores the operator
+// the token belongs to in the request context under models.OperatorKey.
+func New(log *slog.Logger, tokens map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log.Info("admin auth middleware enabled", "operators", len(tokens))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, bearerPrefix) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			operator, ok := lookup(tokens, strings.TrimPrefix(authHeader, bearerPrefix))
+			if !ok {
+				log.Warn("rejected admin token", "path", r.URL.Path, "remote_address", r.RemoteAddr)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), models.OperatorKey, operator)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func lookup(tokens map[string]string, token string) (string, bool) {
+	var operator string
+	found := false
+	for known, name := range tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			operator = name
+			found = true
+		}
+	}
+	return operator, found && token != ""
+}
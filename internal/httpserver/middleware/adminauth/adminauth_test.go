@@ -0,0 +1,48 @@
+package adminauth
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+func TestAdminAuth(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := New(log, map[string]string{"token-a": "alice", "token-b": "bob"})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operator, _ := r.Context().Value(models.OperatorKey).(string)
+			io.WriteString(w, operator)
+		}))
+
+	tests := []struct {
+		name   string
+		header string
+		code   int
+		want   string
+	}{
+		{name: "missing header", code: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "token-a", code: http.StatusUnauthorized},
+		{name: "unknown token", header: "Bearer token-c", code: http.StatusUnauthorized},
+		{name: "empty token", header: "Bearer ", code: http.StatusUnauthorized},
+		{name: "first operator", header: "Bearer token-a", code: http.StatusOK, want: "alice"},
+		{name: "second operator", header: "Bearer token-b", code: http.StatusOK, want: "bob"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin/accrual/pool", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.code)
+		}
+		if tt.code == http.StatusOK && rec.Body.String() != tt.want {
+			t.Errorf("%s: operator %q, want %q", tt.name, rec.Body.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	maxKeyLength   = 255
+	maxBodySize    = 1 << 20
+)
+
+type Store interface {
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, expiredBefore int64) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error
+}
+
+func New(log *slog.Logger, store Store, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			const op = "middleware.Idempotency"
+
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log := log.With(
+				slog.String("op", op),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("idempotency_key", key),
+			)
+
+			if len(key) > maxKeyLength {
+				http.Error(w, "invalid idempotency key", http.StatusBadRequest)
+				return
+			}
+			userID, ok := r.Context().Value(models.UserIDKey).(int64)
+			if !ok || userID == 0 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			record := &models.IdempotencyRecord{
+				UserID:      userID,
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now.Unix(),
+			}
+			existing, err := store.ReserveIdempotencyKey(r.Context(), record, now.Add(-ttl).Unix())
+			if err != nil {
+				log.Error("failed to reserve idempotency key", "error", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				replay(log, w, record, existing)
+				return
+			}
+
+			completed := false
+			ctx := context.WithoutCancel(r.Context())
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.ReleaseIdempotencyKey(ctx, userID, key); err != nil {
+					log.Error("failed to release idempotency key", "error", err)
+				}
+			}()
+
+			var captured bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&captured)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError {
+				return
+			}
+			if err := store.CompleteIdempotencyKey(ctx, userID, key, status, ww.Header().Get("Content-Type"), captured.Bytes()); err != nil {
+				log.Error("failed to store idempotent response", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func replay(log *slog.Logger, w http.ResponseWriter, record, existing *models.IdempotencyRecord) {
+	if existing.Fingerprint != record.Fingerprint {
+		log.Warn("idempotency key reused", "error", models.ErrIdempotencyMismatch)
+		http.Error(w, models.ErrIdempotencyMismatch.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if !existing.Completed() {
+		log.Warn("idempotency key in flight", "error", models.ErrIdempotencyInFlight)
+		http.Error(w, models.ErrIdempotencyInFlight.Error(), http.StatusConflict)
+		return
+	}
+
+	log.Info("replaying idempotent response", slog.Int("status", existing.Status))
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(existing.Status)
+	if _, err := w.Write(existing.Body); err != nil {
+		log.Error("failed to write replayed response", "error", err)
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -6,14 +6,27 @@ import (
 	"net/http"
 
 	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/accrualcallback"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/addorder"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/addtransfer"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/addwithdraw"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/cancelwithdraw"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/confirmwithdraw"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getbalance"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getorder"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getprofile"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getreferrals"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getstatement"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/gettransfers"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/getwithdrawals"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/login"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/poolstats"
 	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/register"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/reservewithdraw"
+	"github.com/ArtShib/gophermart.git/internal/httpserver/handlers/reversewithdrawal"
+	mwAdminAuth "github.com/ArtShib/gophermart.git/internal/httpserver/middleware/adminauth"
 	mwAuth "github.com/ArtShib/gophermart.git/internal/httpserver/middleware/auth"
+	mwIdempotency "github.com/ArtShib/gophermart.git/internal/httpserver/middleware/idempotency"
 	mwLogger "github.com/ArtShib/gophermart.git/internal/httpserver/middleware/logger"
 	"github.com/ArtShib/gophermart.git/internal/models"
 	"github.com/go-chi/chi"
@@ -21,7 +34,7 @@ import (
 )
 
 type AuthService interface {
-	RegisterNewUser(ctx context.Context, login string, pass string, secretKey []byte) (string, error)
+	RegisterNewUser(ctx context.Context, login string, pass string, referralCode string, secretKey []byte) (string, error)
 	Login(ctx context.Context, login string, password string, secretKey []byte) (string, error)
 	ParseToken(tokenString string, secretKey []byte) (int64, error)
 }
@@ -31,10 +44,43 @@ type Order interface {
 	Get(ctx context.Context, userID int64) (models.OrderArray, error)
 	Balance(ctx context.Context, userID int64) (*models.Balance, error)
 	Withdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error)
-	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64) error
+	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) error
+	Statement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error)
+	ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) (*models.Reservation, error)
+	ConfirmWithdraw(ctx context.Context, numOrder int64, userID int64) error
+	CancelWithdraw(ctx context.Context, numOrder int64, userID int64) error
 }
 
-func New(svc AuthService, order Order, log *slog.Logger, cfg *config.Config) http.Handler {
+type Tier interface {
+	Profile(ctx context.Context, userID int64) (*models.Profile, error)
+}
+
+type Transfer interface {
+	Send(ctx context.Context, fromUserID int64, toLogin string, sum models.Money) (*models.UserTransfer, error)
+	History(ctx context.Context, userID int64) (models.UserTransferArray, error)
+}
+
+type Referral interface {
+	Stats(ctx context.Context, userID int64) (*models.ReferralStats, error)
+}
+
+type AccrualCallback interface {
+	Push(ctx context.Context, orders models.ResAccrualOrderArray) error
+}
+
+type CallbackReplays interface {
+	RememberCallbackSignature(ctx context.Context, signature string, expiresAt int64) (bool, error)
+}
+
+type AccrualPool interface {
+	Stats() models.PoolStats
+}
+
+type Refund interface {
+	Reverse(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string) (*models.Withdrawals, error)
+}
+
+func New(svc AuthService, order Order, tier Tier, transfer Transfer, referral Referral, accrual AccrualCallback, replays CallbackReplays, keys mwIdempotency.Store, log *slog.Logger, cfg *config.Config) http.Handler {
 
 	mux := chi.NewRouter()
 	mux.Use(middleware.RequestID)
@@ -47,13 +93,41 @@ func New(svc AuthService, order Order, log *slog.Logger, cfg *config.Config) htt
 		r.Post("/login", login.New(log, svc, cfg))
 	})
 
+	if cfg.CallbackSecret != "" {
+		mux.Post("/api/internal/accrual/callback", accrualcallback.New(log, accrual, replays, cfg))
+	}
+
 	mux.Group(func(r chi.Router) {
 		r.Use(mwAuth.New(log, svc, cfg))
-		r.Post("/api/user/orders", addorder.New(log, order))
 		r.Get("/api/user/orders", getorder.New(log, order))
 		r.Get("/api/user/balance", getbalance.New(log, order))
 		r.Get("/api/user/withdrawals", getwithdrawals.New(log, order))
-		r.Post("/api/user/balance/withdraw", addwithdraw.New(log, order))
+		r.Get("/api/user/statement", getstatement.New(log, order))
+		r.Get("/api/user/profile", getprofile.New(log, tier))
+		r.Get("/api/user/transfers", gettransfers.New(log, transfer))
+		r.Get("/api/user/referrals", getreferrals.New(log, referral))
+		r.Group(func(r chi.Router) {
+			r.Use(mwIdempotency.New(log, keys, cfg.Housekeeping.IdempotencyTTL))
+			r.Post("/api/user/orders", addorder.New(log, order))
+			r.Post("/api/user/balance/withdraw", addwithdraw.New(log, order))
+			r.Post("/api/user/balance/reservations", reservewithdraw.New(log, order))
+			r.Post("/api/user/balance/transfer", addtransfer.New(log, transfer))
+		})
+		r.Post("/api/user/balance/reservations/{number}/confirm", confirmwithdraw.New(log, order))
+		r.Post("/api/user/balance/reservations/{number}/cancel", cancelwithdraw.New(log, order))
 	})
 	return mux
 }
+
+func NewAdmin(pool AccrualPool, refund Refund, tokens map[string]string, log *slog.Logger) http.Handler {
+
+	mux := chi.NewRouter()
+	mux.Use(middleware.RequestID)
+	mux.Use(middleware.Recoverer)
+	mux.Use(mwLogger.New(log))
+	mux.Use(mwAdminAuth.New(log, tokens))
+
+	mux.Get("/admin/accrual/pool", poolstats.New(log, pool))
+	mux.Post("/admin/withdrawals/{number}/reversals", reversewithdrawal.New(log, refund))
+	return mux
+}
@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type stubPool struct{}
+
+func (stubPool) Stats() models.PoolStats {
+	return models.PoolStats{}
+}
+
+type recordingRefund struct {
+	operators []string
+}
+
+func (r *recordingRefund) Reverse(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string) (*models.Withdrawals, error) {
+	r.operators = append(r.operators, operator)
+	return &models.Withdrawals{OrderNum: numOrder, Sum: -sum, ReversedBy: operator, Reason: reason}, nil
+}
+
+func TestAdminReversalTakesOperatorFromToken(t *testing.T) {
+	refund := &recordingRefund{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := httptest.NewServer(NewAdmin(stubPool{}, refund, map[string]string{"support-token": "support"}, log))
+	t.Cleanup(server.Close)
+
+	reverse := func(token string) int {
+		t.Helper()
+		body := `{"sum":50,"operator":"mallory","reason":"refund"}`
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/admin/withdrawals/2377225624/reversals", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := reverse(""); code != http.StatusUnauthorized {
+		t.Fatalf("without token: got %d", code)
+	}
+	if code := reverse("guess"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: got %d", code)
+	}
+	if len(refund.operators) != 0 {
+		t.Fatalf("unauthenticated reversal reached the service: %v", refund.operators)
+	}
+	if code := reverse("support-token"); code != http.StatusCreated {
+		t.Fatalf("authenticated reversal: got %d", code)
+	}
+	if len(refund.operators) != 1 || refund.operators[0] != "support" {
+		t.Fatalf("operator: got %v, want [support]", refund.operators)
+	}
+
+	resp, err := http.Get(server.URL + "/admin/accrual/pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("pool stats without token: got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,156 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type Breaker struct {
+	mu               sync.Mutex
+	state            State
+	failures         int
+	openedAt         time.Time
+	probes           int
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenMax      int
+	onChange         func(from, to State)
+}
+
+func New(failureThreshold int, openTimeout time.Duration, halfOpenMax int, onChange func(from, to State)) *Breaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	if halfOpenMax < 1 {
+		halfOpenMax = 1
+	}
+	return &Breaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		halfOpenMax:      halfOpenMax,
+		onChange:         onChange,
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	from, to := b.refresh()
+	state := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return state
+}
+
+func (b *Breaker) Ready() bool {
+	return b.State() != StateOpen
+}
+
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	from, to := b.refresh()
+	allowed := true
+	switch b.state {
+	case StateOpen:
+		allowed = false
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenMax {
+			allowed = false
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+	b.notify(from, to)
+	return allowed
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.failures = 0
+	if b.state == StateHalfOpen {
+		b.probes--
+		b.state = StateClosed
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		b.trip()
+	case StateClosed:
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.trip()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// Release returns a call admitted by Allow without recording an outcome, so
+// an abandoned half-open probe neither closes nor trips the breaker.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mu.Unlock()
+}
+
+func (b *Breaker) OpenUntil() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return time.Time{}
+	}
+	return b.openedAt.Add(b.openTimeout)
+}
+
+func (b *Breaker) trip() {
+	b.state = StateOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
+
+func (b *Breaker) refresh() (State, State) {
+	from := b.state
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.openTimeout {
+		b.state = StateHalfOpen
+		b.probes = 0
+	}
+	return from, b.state
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
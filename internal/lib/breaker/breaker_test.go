@@ -0,0 +1,89 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerTripsAfterThreshold(t *testing.T) {
+	var changes []State
+	b := New(3, time.Minute, 1, func(from, to State) {
+		changes = append(changes, to)
+	})
+
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("success resets failures: got %s", state)
+	}
+	b.Failure()
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("threshold reached: got %s", state)
+	}
+	if b.Allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+	if b.OpenUntil().IsZero() {
+		t.Fatal("open breaker has no deadline")
+	}
+	if len(changes) != 1 || changes[0] != StateOpen {
+		t.Fatalf("state changes: got %v", changes)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	b := New(1, 10*time.Millisecond, 2, nil)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if state := b.State(); state != StateHalfOpen {
+		t.Fatalf("after open timeout: got %s", state)
+	}
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("half-open breaker refused its probes")
+	}
+	if b.Allow() {
+		t.Fatal("half-open breaker allowed more probes than configured")
+	}
+	b.Success()
+	if state := b.State(); state != StateClosed {
+		t.Fatalf("successful probe: got %s", state)
+	}
+	if !b.OpenUntil().IsZero() {
+		t.Fatal("closed breaker reports an open deadline")
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b := New(1, 10*time.Millisecond, 1, nil)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.Allow() {
+		t.Fatal("half-open breaker refused a probe")
+	}
+	b.Failure()
+	if state := b.State(); state != StateOpen {
+		t.Fatalf("failed probe: got %s", state)
+	}
+}
+
+func TestBreakerReleaseFreesProbe(t *testing.T) {
+	b := New(1, 10*time.Millisecond, 1, nil)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.Allow() {
+		t.Fatal("half-open breaker refused a probe")
+	}
+	b.Release()
+	if state := b.State(); state != StateHalfOpen {
+		t.Fatalf("released probe changed state: got %s", state)
+	}
+	if !b.Allow() {
+		t.Fatal("released probe slot was not returned")
+	}
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBurstPassesThenWaitsForRefill(t *testing.T) {
+	l := New(20, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("burst waited %s", elapsed)
+	}
+
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("request past the burst waited only %s, want about 50ms", elapsed)
+	}
+}
+
+func TestZeroRateIsUnlimited(t *testing.T) {
+	l := New(0, 1)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("unlimited limiter waited %s", elapsed)
+	}
+}
+
+func TestWaitHonoursCancellation(t *testing.T) {
+	l := New(0.1, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait: got %v, want deadline exceeded", err)
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	l := New(0.1, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	l.SetRate(100)
+	if got := l.Rate(); got != 100 {
+		t.Fatalf("rate: got %v, want 100", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatalf("wait after speeding up: %v", err)
+	}
+}
+
+func TestNewClampsBurst(t *testing.T) {
+	l := New(1, 0)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Fatal("second request passed a burst of one")
+	}
+}
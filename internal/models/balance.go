@@ -1,6 +1,20 @@
 package models
 
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   Money               `json:"current"`
+	Withdrawn Money               `json:"withdrawn"`
+	Reserved  Money               `json:"reserved"`
+	Expiring  ExpiringPointsArray `json:"expiring,omitempty"`
 }
+
+type BalanceDrift struct {
+	UserID            int64 `json:"user_id"`
+	Current           Money `json:"current"`
+	ExpectedCurrent   Money `json:"expected_current"`
+	Withdrawn         Money `json:"withdrawn"`
+	ExpectedWithdrawn Money `json:"expected_withdrawn"`
+	Reserved          Money `json:"reserved"`
+	ExpectedReserved  Money `json:"expected_reserved"`
+}
+
+type BalanceDriftArray []BalanceDrift
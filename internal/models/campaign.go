@@ -0,0 +1,106 @@
+package models
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+type Campaign struct {
+	Name           string
+	StartsAt       int64
+	EndsAt         int64
+	Multiplier     Money
+	Bonus          Money
+	NewUsersWithin time.Duration
+	Tiers          []string
+	MinOrders      int
+	MaxOrders      int
+	Stackable      bool
+}
+
+type CampaignArray []Campaign
+
+// CampaignSubject describes an order that has just reached PROCESSED.
+// OrderCount is the order's position among the user's processed orders, starting at 1.
+type CampaignSubject struct {
+	Accrual      Money
+	ProcessedAt  int64
+	RegisteredAt int64
+	Tier         string
+	OrderCount   int
+}
+
+type OrderBonus struct {
+	Campaign string `json:"campaign"`
+	Amount   Money  `json:"amount"`
+}
+
+type OrderBonusArray []OrderBonus
+
+func (b OrderBonusArray) Total() Money {
+	var total Money
+	for _, bonus := range b {
+		total += bonus.Amount
+	}
+	return total
+}
+
+func (c Campaign) Eligible(s CampaignSubject) bool {
+	switch {
+	case c.StartsAt != 0 && s.ProcessedAt < c.StartsAt:
+		return false
+	case c.EndsAt != 0 && s.ProcessedAt >= c.EndsAt:
+		return false
+	case c.NewUsersWithin > 0 && s.ProcessedAt-s.RegisteredAt > int64(c.NewUsersWithin/time.Second):
+		return false
+	case len(c.Tiers) > 0 && !slices.Contains(c.Tiers, s.Tier):
+		return false
+	case c.MinOrders > 0 && s.OrderCount < c.MinOrders:
+		return false
+	case c.MaxOrders > 0 && s.OrderCount > c.MaxOrders:
+		return false
+	}
+	return true
+}
+
+// BonusFor returns the points a campaign adds on top of a base accrual:
+// the multiplier's extra share of it plus the fixed bonus.
+func (c Campaign) BonusFor(base Money) Money {
+	bonus := c.Bonus
+	if c.Multiplier > moneyScale {
+		bonus += base.Scale(c.Multiplier - moneyScale)
+	}
+	return bonus
+}
+
+// Apply picks the bonuses that apply to s. Stackable campaigns add up; an
+// exclusive campaign stands alone, and whichever option pays more wins.
+func (a CampaignArray) Apply(s CampaignSubject) OrderBonusArray {
+	stacked := OrderBonusArray{}
+	var exclusive *OrderBonus
+	for _, campaign := range a {
+		if !campaign.Eligible(s) {
+			continue
+		}
+		bonus := OrderBonus{Campaign: campaign.Name, Amount: campaign.BonusFor(s.Accrual)}
+		if bonus.Amount <= 0 {
+			continue
+		}
+		if campaign.Stackable {
+			stacked = append(stacked, bonus)
+			continue
+		}
+		if exclusive == nil || bonus.Amount > exclusive.Amount {
+			exclusive = &bonus
+		}
+	}
+
+	if exclusive != nil && exclusive.Amount >= stacked.Total() {
+		return OrderBonusArray{*exclusive}
+	}
+	sort.SliceStable(stacked, func(i, j int) bool {
+		return stacked[i].Campaign < stacked[j].Campaign
+	})
+	return stacked
+}
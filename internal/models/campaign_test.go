@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCampaignApply(t *testing.T) {
+	weekend := Campaign{Name: "double-weekend", StartsAt: 1000, EndsAt: 2000, Multiplier: 200, Stackable: true}
+	firstOrder := Campaign{Name: "first-order", Bonus: 5000, MaxOrders: 1, Stackable: true}
+	newcomers := Campaign{Name: "newcomers", Multiplier: 150, NewUsersWithin: time.Hour}
+	gold := Campaign{Name: "gold", Multiplier: 300, Tiers: []string{"gold"}}
+	campaigns := CampaignArray{weekend, firstOrder, newcomers, gold}
+
+	tests := []struct {
+		name    string
+		subject CampaignSubject
+		want    OrderBonusArray
+	}{
+		{
+			name:    "nothing eligible",
+			subject: CampaignSubject{Accrual: 10000, ProcessedAt: 5000, Tier: "bronze", OrderCount: 2},
+			want:    OrderBonusArray{},
+		},
+		{
+			name:    "stackable campaigns add up",
+			subject: CampaignSubject{Accrual: 10000, ProcessedAt: 1500, RegisteredAt: -10000, Tier: "bronze", OrderCount: 1},
+			want:    OrderBonusArray{{Campaign: "double-weekend", Amount: 10000}, {Campaign: "first-order", Amount: 5000}},
+		},
+		{
+			name:    "stack beats a smaller exclusive",
+			subject: CampaignSubject{Accrual: 10000, ProcessedAt: 1500, RegisteredAt: 1000, Tier: "bronze", OrderCount: 1},
+			want:    OrderBonusArray{{Campaign: "double-weekend", Amount: 10000}, {Campaign: "first-order", Amount: 5000}},
+		},
+		{
+			name:    "larger exclusive wins alone",
+			subject: CampaignSubject{Accrual: 10000, ProcessedAt: 1500, RegisteredAt: 1000, Tier: "gold", OrderCount: 1},
+			want:    OrderBonusArray{{Campaign: "gold", Amount: 20000}},
+		},
+		{
+			name:    "window end is exclusive",
+			subject: CampaignSubject{Accrual: 10000, ProcessedAt: 2000, RegisteredAt: 1500, Tier: "bronze", OrderCount: 3},
+			want:    OrderBonusArray{{Campaign: "newcomers", Amount: 5000}},
+		},
+	}
+	for _, tt := range tests {
+		got := campaigns.Apply(tt.subject)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestMoneyScale(t *testing.T) {
+	tests := []struct {
+		m, factor, want Money
+	}{
+		{10000, 100, 10000},
+		{333, 50, 167},
+		{-333, 50, -167},
+		{1, 49, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Scale(tt.factor); got != tt.want {
+			t.Errorf("Money(%d).Scale(%d) = %d, want %d", tt.m, tt.factor, got, tt.want)
+		}
+	}
+}
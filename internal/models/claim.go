@@ -0,0 +1,50 @@
+package models
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ClaimRoute mirrors an accrual routing rule: an empty Prefix or UserIDs
+// matches any order.
+type ClaimRoute struct {
+	Prefix  string
+	UserIDs []int64
+	Skip    bool
+}
+
+func (r ClaimRoute) Match(numOrder int64, userID int64) bool {
+	if r.Prefix != "" && !strings.HasPrefix(strconv.FormatInt(numOrder, 10), r.Prefix) {
+		return false
+	}
+	return len(r.UserIDs) == 0 || slices.Contains(r.UserIDs, userID)
+}
+
+// ClaimFilter tells ClaimOrdersInWork which orders to leave alone. The first
+// matching route decides; orders matching no route follow SkipDefault.
+type ClaimFilter struct {
+	Routes      []ClaimRoute
+	SkipDefault bool
+}
+
+func (f ClaimFilter) Skips(numOrder int64, userID int64) bool {
+	for _, route := range f.Routes {
+		if route.Match(numOrder, userID) {
+			return route.Skip
+		}
+	}
+	return f.SkipDefault
+}
+
+func (f ClaimFilter) SkipsNone() bool {
+	if f.SkipDefault {
+		return false
+	}
+	for _, route := range f.Routes {
+		if route.Skip {
+			return false
+		}
+	}
+	return true
+}
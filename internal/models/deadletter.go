@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+type DeadLetterOrder struct {
+	Number         int64
+	UserID         int64
+	Status         string
+	Attempts       int
+	Failures       int
+	LastError      string
+	UploadedAt     int64
+	DeadLetteredAt int64
+}
+
+func (d DeadLetterOrder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Number         string `json:"number"`
+		UserID         int64  `json:"user_id"`
+		Status         string `json:"status"`
+		Attempts       int    `json:"attempts"`
+		Failures       int    `json:"failures"`
+		LastError      string `json:"last_error"`
+		UploadedAt     string `json:"uploaded_at"`
+		DeadLetteredAt string `json:"dead_lettered_at"`
+	}{
+		Number:         strconv.FormatInt(d.Number, 10),
+		UserID:         d.UserID,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		Failures:       d.Failures,
+		LastError:      d.LastError,
+		UploadedAt:     time.Unix(d.UploadedAt, 0).Format(time.RFC3339),
+		DeadLetteredAt: time.Unix(d.DeadLetteredAt, 0).Format(time.RFC3339),
+	})
+}
+
+type DeadLetterOrderArray []DeadLetterOrder
@@ -0,0 +1,17 @@
+package models
+
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   int64
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	LedgerAccountUser       = "user"
+	LedgerAccountAccrual    = "system:accrual"
+	LedgerAccountWithdrawal = "system:withdrawal"
+	LedgerAccountAdjustment = "system:adjustment"
+	LedgerAccountExpiration = "system:expiration"
+	LedgerAccountCampaign   = "system:campaign"
+	LedgerAccountReferral   = "system:referral"
+)
+
+const (
+	LedgerKindAccrual    = "ACCRUAL"
+	LedgerKindWithdrawal = "WITHDRAWAL"
+	LedgerKindReversal   = "REVERSAL"
+	LedgerKindAdjustment = "ADJUSTMENT"
+	LedgerKindExpiration = "EXPIRATION"
+	LedgerKindBonus      = "BONUS"
+	LedgerKindTransfer   = "TRANSFER"
+	LedgerKindReferral   = "REFERRAL"
+)
+
+type LedgerEntry struct {
+	ID          int64
+	TxID        int64
+	UserID      int64
+	Account     string
+	Kind        string
+	Amount      Money
+	OrderNum    int64
+	Description string
+	CreatedAt   int64
+}
+
+func (l LedgerEntry) MarshalJSON() ([]byte, error) {
+	var orderNum string
+	if l.OrderNum != 0 {
+		orderNum = strconv.FormatInt(l.OrderNum, 10)
+	}
+	return json.Marshal(struct {
+		ID          int64  `json:"id"`
+		TxID        int64  `json:"tx_id"`
+		Kind        string `json:"kind"`
+		Amount      Money  `json:"amount"`
+		OrderNum    string `json:"order,omitempty"`
+		Description string `json:"description,omitempty"`
+		CreatedAt   string `json:"created_at"`
+	}{
+		ID:          l.ID,
+		TxID:        l.TxID,
+		Kind:        l.Kind,
+		Amount:      l.Amount,
+		OrderNum:    orderNum,
+		Description: l.Description,
+		CreatedAt:   time.Unix(l.CreatedAt, 0).Format(time.RFC3339),
+	})
+}
+
+type LedgerEntryArray []LedgerEntry
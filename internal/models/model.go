@@ -1,6 +1,10 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrUserExists           = errors.New("user already exists")
@@ -12,11 +16,51 @@ var (
 	ErrOrderEmpty           = errors.New("order is empty")
 	ErrWithdrawalsEmpty     = errors.New("withdrawals is empty")
 	ErrWithdrawBalanceUser  = errors.New("there are not enough bonuses to deduct")
+	ErrWithdrawalExists     = errors.New("withdrawal already exists")
 	ErrOrdersInWorkIsEmpty  = errors.New("list of orders is empty")
+	ErrOrderNotRegistered   = errors.New("order is not registered in accrual system")
+	ErrUnknownAccrualStatus = errors.New("unknown accrual status")
+	ErrIllegalTransition    = errors.New("illegal order status transition")
+	ErrDeadLetterNotFound   = errors.New("dead-lettered order not found")
+	ErrDeadLetterEmpty      = errors.New("dead letter queue is empty")
+	ErrAccrualUnavailable   = errors.New("accrual system is unavailable")
+	ErrCircuitOpen          = errors.New("accrual circuit breaker is open")
+	ErrStatementEmpty       = errors.New("statement is empty")
+	ErrInvalidAdjustment    = errors.New("adjustment amount must not be zero")
+	ErrIdempotencyInFlight  = errors.New("request with this idempotency key is in progress")
+	ErrIdempotencyMismatch  = errors.New("idempotency key was used with a different request")
+	ErrReservationNotFound  = errors.New("reservation not found")
+	ErrReservationExpired   = errors.New("reservation has expired")
+	ErrReservationClosed    = errors.New("reservation is already confirmed or cancelled")
+	ErrWithdrawalNotFound   = errors.New("withdrawal not found")
+	ErrReversalTooLarge     = errors.New("reversal exceeds the withdrawn sum")
+	ErrInvalidReversal      = errors.New("reversal sum must be positive")
+	ErrInvalidWithdrawSum   = errors.New("withdrawal sum must be positive")
+	ErrReversalUnattributed = errors.New("reversal requires an operator and a reason")
+	ErrBonusApplied         = errors.New("order bonus has already been applied")
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrInvalidTransfer      = errors.New("transfer sum must be positive")
+	ErrTransferToSelf       = errors.New("cannot transfer points to yourself")
+	ErrTransferLimit        = errors.New("daily transfer limit exceeded")
+	ErrTransfersEmpty       = errors.New("transfers is empty")
+	ErrInvalidReferralCode  = errors.New("referral code does not exist")
+	ErrReferralCodeTaken    = errors.New("referral code is already taken")
+	ErrReferralRewarded     = errors.New("referral has already been rewarded")
 )
 
+type RateLimitError struct {
+	RetryAfter        time.Duration
+	RequestsPerMinute int
+	Message           string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many requests, retry after %s: %s", e.RetryAfter, e.Message)
+}
+
 type contextKey string
 
 const (
-	UserIDKey contextKey = "userID"
+	UserIDKey   contextKey = "userID"
+	OperatorKey contextKey = "operator"
 )
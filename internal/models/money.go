@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const moneyScale = 100
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+type Money int64
+
+var moneyPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]{1,2})?$`)
+
+// ParseMoney parses a plain decimal with at most two fraction digits. Anything
+// finer is rejected rather than rounded, so a client moves exactly what it sent.
+func ParseMoney(s string) (Money, error) {
+	if !moneyPattern.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	digits := strings.TrimLeft(s, "+-")
+	units, frac, _ := strings.Cut(digits, ".")
+	frac += "00"[len(frac):]
+
+	v, err := strconv.ParseInt(units+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	if s[0] == '-' {
+		v = -v
+	}
+	return Money(v), nil
+}
+
+// roundMoney parses any decimal number, rounding half away from zero to whole
+// cents. It is reserved for amounts we do not control: values scanned from the
+// database and accruals reported by the accrual system.
+func roundMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Abs(new(big.Int).Mul(rem, big.NewInt(2))).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(int64(num.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	return Money(quo.Int64()), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	units, cents := v/moneyScale, v%moneyScale
+	if cents == 0 {
+		return sign + strconv.FormatInt(units, 10)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%02d", sign, units, cents), "0")
+}
+
+// Scale multiplies m by factor, itself expressed in hundredths, rounding half away from zero.
+func (m Money) Scale(factor Money) Money {
+	product := int64(m) * int64(factor)
+	quo, rem := product/moneyScale, product%moneyScale
+	if rem*2 >= moneyScale {
+		quo++
+	} else if rem*2 <= -moneyScale {
+		quo--
+	}
+	return Money(quo)
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*m = 0
+		return nil
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case int64:
+		*m = Money(v * moneyScale)
+		return nil
+	case float64:
+		parsed, err := roundMoney(strconv.FormatFloat(v, 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := roundMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case []byte:
+		parsed, err := roundMoney(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+	return fmt.Errorf("%w: cannot scan %T", ErrInvalidMoney, src)
+}
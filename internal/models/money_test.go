@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"500", 50000},
+		{"729.98", 72998},
+		{"0.1", 10},
+		{"-12.5", -1250},
+		{"+3.07", 307},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"abc", "", "1/3", "1e3", "0.005", ".5", "5.", " 5", "1.2.3", "99999999999999999999"} {
+		if _, err := ParseMoney(in); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q) error = %v, want ErrInvalidMoney", in, err)
+		}
+	}
+}
+
+func TestRoundMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"1e2", 10000},
+		{"0.005", 1},
+		{"-0.005", -1},
+		{"0.004", 0},
+		{"729.98000", 72998},
+	}
+	for _, tt := range tests {
+		got, err := roundMoney(tt.in)
+		if err != nil {
+			t.Fatalf("roundMoney(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("roundMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	var res ResAccrualOrder
+	if err := json.Unmarshal([]byte(`{"order":"79927398713","status":"PROCESSED","accrual":729.985}`), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Accrual != 72999 {
+		t.Errorf("accrual = %d, want 72999", res.Accrual)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var sum Money
+	for i := 0; i < 10; i++ {
+		var m Money
+		if err := json.Unmarshal([]byte("0.1"), &m); err != nil {
+			t.Fatal(err)
+		}
+		sum += m
+	}
+	data, err := json.Marshal(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Errorf("ten times 0.1 = %s, want 1", data)
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"1.5"`), &m); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("Unmarshal of a quoted amount error = %v, want ErrInvalidMoney", err)
+	}
+
+	data, _ = json.Marshal(Money(72998))
+	if string(data) != "729.98" {
+		t.Errorf("Marshal(72998) = %s, want 729.98", data)
+	}
+}
@@ -2,28 +2,77 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 )
 
+const (
+	StatusNew        = "NEW"
+	StatusRegistered = "REGISTERED"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+	StatusInvalid    = "INVALID"
+	StatusUnknown    = "UNKNOWN"
+)
+
+var orderTransitions = map[string][]string{
+	StatusNew:        {StatusProcessing, StatusProcessed, StatusInvalid, StatusUnknown},
+	StatusProcessing: {StatusProcessed, StatusInvalid, StatusUnknown},
+}
+
+func AccrualStatusToOrder(status string) (string, error) {
+	switch status {
+	case StatusRegistered, StatusProcessing:
+		return StatusProcessing, nil
+	case StatusProcessed, StatusInvalid:
+		return status, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownAccrualStatus, status)
+}
+
+func IsTerminalStatus(status string) bool {
+	return status == StatusProcessed || status == StatusInvalid || status == StatusUnknown
+}
+
+func CanTransition(from, to string) bool {
+	if from == to {
+		return !IsTerminalStatus(from)
+	}
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
-	Number     int64   `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual"`
-	UploadedAt int64   `json:"uploaded_at"`
+	Number     int64  `json:"number"`
+	Status     string `json:"status"`
+	Accrual    Money  `json:"accrual"`
+	Bonus      Money  `json:"bonus"`
+	UploadedAt int64  `json:"uploaded_at"`
 	UserID     int64
+	Attempts   int
 }
 
 func (o Order) MarshalJSON() ([]byte, error) {
+	status := o.Status
+	if status == StatusUnknown {
+		status = StatusInvalid
+	}
 	return json.Marshal(struct {
-		Number     string  `json:"number"`
-		Status     string  `json:"status"`
-		Accrual    float64 `json:"accrual"`
-		UploadedAt string  `json:"uploaded_at"`
+		Number     string `json:"number"`
+		Status     string `json:"status"`
+		Accrual    Money  `json:"accrual"`
+		Bonus      Money  `json:"bonus,omitempty"`
+		UploadedAt string `json:"uploaded_at"`
 	}{
 		Number:     strconv.FormatInt(o.Number, 10),
-		Status:     o.Status,
+		Status:     status,
 		Accrual:    o.Accrual,
+		Bonus:      o.Bonus,
 		UploadedAt: time.Unix(o.UploadedAt, 0).Format(time.RFC3339),
 	})
 }
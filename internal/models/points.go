@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+type PointLot struct {
+	ID        int64
+	UserID    int64
+	Source    string
+	OrderNum  int64
+	Amount    Money
+	Remaining Money
+	EarnedAt  int64
+	ExpiresAt int64
+}
+
+type ExpiringPoints struct {
+	Date   int64
+	Amount Money
+}
+
+func (e ExpiringPoints) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Date   string `json:"date"`
+		Amount Money  `json:"amount"`
+	}{
+		Date:   time.Unix(e.Date, 0).UTC().Format(time.DateOnly),
+		Amount: e.Amount,
+	})
+}
+
+type ExpiringPointsArray []ExpiringPoints
+
+// PointsExpireAt returns when points earned at earned stop being spendable,
+// or 0 if a non-positive lifetime means they never expire.
+func PointsExpireAt(earned int64, lifetimeMonths int) int64 {
+	if lifetimeMonths <= 0 {
+		return 0
+	}
+	return time.Unix(earned, 0).UTC().AddDate(0, lifetimeMonths, 0).Unix()
+}
+
+// ExpiryDay truncates an expiry timestamp to the start of its UTC day.
+func ExpiryDay(expiresAt int64) int64 {
+	return expiresAt - expiresAt%secondsPerDay
+}
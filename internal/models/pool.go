@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+type PoolStats struct {
+	ActiveWorkers int                `json:"active_workers"`
+	MinWorkers    int                `json:"min_workers"`
+	MaxWorkers    int                `json:"max_workers"`
+	QueueDepth    int                `json:"queue_depth"`
+	QueueCapacity int                `json:"queue_capacity"`
+	BufferSize    int                `json:"buffer_size"`
+	BatchSize     int                `json:"batch_size"`
+	LastFlushAt   time.Time          `json:"last_flush_at,omitzero"`
+	Providers     []ProviderStats    `json:"providers"`
+	InFlight      InFlightOrderArray `json:"in_flight"`
+}
+
+type ProviderStats struct {
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Breaker     string    `json:"breaker"`
+	RateLimit   float64   `json:"rate_limit"`
+	PausedUntil time.Time `json:"paused_until,omitzero"`
+}
+
+type InFlightOrder struct {
+	Number int64
+	Since  time.Time
+}
+
+func (o InFlightOrder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Number string `json:"number"`
+		Since  string `json:"since"`
+	}{
+		Number: strconv.FormatInt(o.Number, 10),
+		Since:  o.Since.Format(time.RFC3339),
+	})
+}
+
+type InFlightOrderArray []InFlightOrder
@@ -0,0 +1,17 @@
+package models
+
+type ReferralReward struct {
+	ReferredUserID int64
+	ReferrerID     int64
+	OrderNum       int64
+	ReferrerBonus  Money
+	RefereeBonus   Money
+	CreatedAt      int64
+}
+
+type ReferralStats struct {
+	Code     string `json:"code"`
+	Referred int    `json:"referred"`
+	Rewarded int    `json:"rewarded"`
+	Earned   Money  `json:"earned"`
+}
@@ -6,19 +6,20 @@ import (
 )
 
 type RequestUser struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
 type RequestWithdraw struct {
-	Order int64   `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order int64 `json:"order"`
+	Sum   Money `json:"sum"`
 }
 
 func (r *RequestWithdraw) UnmarshalJSON(data []byte) error {
 	var aux struct {
-		Order string  `json:"order"`
-		Sum   float64 `json:"sum"`
+		Order string `json:"order"`
+		Sum   Money  `json:"sum"`
 	}
 
 	var err error
@@ -36,3 +37,13 @@ func (r *RequestWithdraw) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+type RequestReversal struct {
+	Sum    Money  `json:"sum"`
+	Reason string `json:"reason"`
+}
+
+type RequestTransfer struct {
+	To  string `json:"to"`
+	Sum Money  `json:"sum"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	ReservationReserved  = "RESERVED"
+	ReservationConfirmed = "CONFIRMED"
+	ReservationCancelled = "CANCELLED"
+	ReservationExpired   = "EXPIRED"
+)
+
+type Reservation struct {
+	ID         int64
+	UserID     int64
+	OrderNum   int64
+	Sum        Money
+	Status     string
+	CreatedAt  int64
+	ExpiresAt  int64
+	ResolvedAt int64
+}
+
+func (r Reservation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		OrderNum  string `json:"order"`
+		Sum       Money  `json:"sum"`
+		Status    string `json:"status"`
+		CreatedAt string `json:"created_at"`
+		ExpiresAt string `json:"expires_at"`
+	}{
+		OrderNum:  strconv.FormatInt(r.OrderNum, 10),
+		Sum:       r.Sum,
+		Status:    r.Status,
+		CreatedAt: time.Unix(r.CreatedAt, 0).Format(time.RFC3339),
+		ExpiresAt: time.Unix(r.ExpiresAt, 0).Format(time.RFC3339),
+	})
+}
+
+func CanResolveReservation(current, to string, expiresAt, now int64) error {
+	switch {
+	case current == ReservationExpired:
+		return ErrReservationExpired
+	case current != ReservationReserved:
+		return ErrReservationClosed
+	case to == ReservationConfirmed && expiresAt <= now:
+		return ErrReservationExpired
+	}
+	return nil
+}
@@ -6,16 +6,16 @@ import (
 )
 
 type ResAccrualOrder struct {
-	OrderNum int64   `json:"order"`
-	Status   string  `json:"status"`
-	Accrual  float64 `json:"accrual"`
+	OrderNum int64  `json:"order"`
+	Status   string `json:"status"`
+	Accrual  Money  `json:"accrual"`
 }
 
 func (r *ResAccrualOrder) UnmarshalJSON(data []byte) error {
 	var aux struct {
-		OrderNum string  `json:"order"`
-		Status   string  `json:"status"`
-		Accrual  float64 `json:"accrual"`
+		OrderNum string      `json:"order"`
+		Status   string      `json:"status"`
+		Accrual  json.Number `json:"accrual"`
 	}
 
 	var err error
@@ -25,7 +25,13 @@ func (r *ResAccrualOrder) UnmarshalJSON(data []byte) error {
 	}
 
 	r.Status = aux.Status
-	r.Accrual = aux.Accrual
+	r.Accrual = 0
+	if aux.Accrual != "" {
+		// The accrual system reports a float; round it to whole cents.
+		if r.Accrual, err = roundMoney(aux.Accrual.String()); err != nil {
+			return err
+		}
+	}
 
 	r.OrderNum, err = strconv.ParseInt(aux.OrderNum, 10, 64)
 	if err != nil {
@@ -0,0 +1,58 @@
+package models
+
+type Tier struct {
+	Name      string
+	Threshold Money
+	Perks     []string
+}
+
+// TierArray is ordered by ascending threshold, starting at zero.
+type TierArray []Tier
+
+// TierFor returns the highest tier lifetime has reached and the tier after it,
+// or nil when lifetime is already in the top tier.
+func (t TierArray) TierFor(lifetime Money) (*Tier, *Tier) {
+	current := 0
+	for i := range t {
+		if lifetime >= t[i].Threshold {
+			current = i
+		}
+	}
+	if current+1 < len(t) {
+		return &t[current], &t[current+1]
+	}
+	return &t[current], nil
+}
+
+type TierChange struct {
+	UserID          int64
+	From            string
+	To              string
+	LifetimeAccrual Money
+	ChangedAt       int64
+}
+
+type Profile struct {
+	Tier            string   `json:"tier"`
+	Perks           []string `json:"perks"`
+	LifetimeAccrual Money    `json:"lifetime_accrual"`
+	NextTier        string   `json:"next_tier,omitempty"`
+	ToNextTier      Money    `json:"to_next_tier,omitempty"`
+}
+
+// ProcessedOrder is an order that has reached PROCESSED. Position is its place
+// among the user's processed orders in the order they were processed, starting
+// at 1, and LifetimeAccrual the user's lifetime accrual once it counted, which
+// fixes the tier the order was earned in; Attempts counts earlier failed
+// deliveries of the event.
+type ProcessedOrder struct {
+	OrderNum        int64
+	UserID          int64
+	Accrual         Money
+	ProcessedAt     int64
+	Position        int
+	LifetimeAccrual Money
+	Attempts        int
+}
+
+type ProcessedOrderArray []ProcessedOrder
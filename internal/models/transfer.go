@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	TransferOut = "out"
+	TransferIn  = "in"
+)
+
+type Transfer struct {
+	ID         int64
+	FromUserID int64
+	FromLogin  string
+	ToUserID   int64
+	ToLogin    string
+	Sum        Money
+	CreatedAt  int64
+}
+
+type TransferArray []Transfer
+
+// TransferLimit caps what a sender may transfer per UTC day; zero values disable a cap.
+type TransferLimit struct {
+	DailySum   Money
+	DailyCount int
+}
+
+func (l TransferLimit) Allows(count int, total Money, sum Money) bool {
+	if l.DailyCount > 0 && count+1 > l.DailyCount {
+		return false
+	}
+	if l.DailySum > 0 && total+sum > l.DailySum {
+		return false
+	}
+	return true
+}
+
+// UserTransfer is a transfer as seen by one of its two parties.
+type UserTransfer struct {
+	ID           int64
+	Direction    string
+	Counterparty string
+	Sum          Money
+	CreatedAt    int64
+}
+
+func (t Transfer) ForUser(userID int64) UserTransfer {
+	view := UserTransfer{ID: t.ID, Direction: TransferIn, Counterparty: t.FromLogin, Sum: t.Sum, CreatedAt: t.CreatedAt}
+	if t.FromUserID == userID {
+		view.Direction = TransferOut
+		view.Counterparty = t.ToLogin
+	}
+	return view
+}
+
+func (t UserTransfer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           int64  `json:"id"`
+		Direction    string `json:"direction"`
+		Counterparty string `json:"counterparty"`
+		Sum          Money  `json:"sum"`
+		CreatedAt    string `json:"created_at"`
+	}{
+		ID:           t.ID,
+		Direction:    t.Direction,
+		Counterparty: t.Counterparty,
+		Sum:          t.Sum,
+		CreatedAt:    time.Unix(t.CreatedAt, 0).Format(time.RFC3339),
+	})
+}
+
+type UserTransferArray []UserTransfer
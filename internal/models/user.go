@@ -3,9 +3,12 @@ package models
 import "github.com/golang-jwt/jwt/v5"
 
 type User struct {
-	ID       int64
-	Login    string
-	PassHash []byte
+	ID           int64
+	Login        string
+	PassHash     []byte
+	CreatedAt    int64
+	ReferralCode string
+	ReferredBy   int64
 }
 
 type UserClaims struct {
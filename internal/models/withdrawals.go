@@ -7,21 +7,42 @@ import (
 )
 
 type Withdrawals struct {
-	OrderNum    int64   `json:"order"`
-	Sum         float64 `json:"sum"`
-	ProcessedAt int64   `json:"processed_at"`
+	OrderNum    int64 `json:"order"`
+	Sum         Money `json:"sum"`
+	ProcessedAt int64 `json:"processed_at"`
+	ID          int64
+	ReversalOf  int64
+	ReversedBy  string
+	Reason      string
 }
 
 func (w Withdrawals) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		OrderNum    string  `json:"order"`
-		Sum         float64 `json:"sum"`
-		ProcessedAt string  `json:"processed_at"`
+		ID          int64  `json:"id,omitempty"`
+		OrderNum    string `json:"order"`
+		Sum         Money  `json:"sum"`
+		ProcessedAt string `json:"processed_at"`
+		ReversalOf  int64  `json:"reversal_of,omitempty"`
+		Reason      string `json:"reason,omitempty"`
 	}{
+		ID:          w.ID,
 		OrderNum:    strconv.FormatInt(w.OrderNum, 10),
 		Sum:         w.Sum,
 		ProcessedAt: time.Unix(w.ProcessedAt, 0).Format(time.RFC3339),
+		ReversalOf:  w.ReversalOf,
+		Reason:      w.Reason,
 	})
 }
 
 type WithdrawalsArray []Withdrawals
+
+func ReversalSum(original, reversed, requested Money) (Money, error) {
+	remaining := original - reversed
+	if requested == 0 {
+		requested = remaining
+	}
+	if requested <= 0 || requested > remaining {
+		return 0, ErrReversalTooLarge
+	}
+	return requested, nil
+}
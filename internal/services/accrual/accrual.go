@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,38 +15,62 @@ import (
 )
 
 type StoreOrder interface {
-	GetOrdersInWork(ctx context.Context) (models.OrderArray, error)
-	UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) error
+	ClaimOrdersInWork(ctx context.Context, owner string, limit int, lease time.Duration, filter models.ClaimFilter) (models.OrderArray, error)
+	RescheduleOrder(ctx context.Context, numOrder int64, owner string, attempts int, nextPollAt int64) error
+	UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) (models.ProcessedOrderArray, error)
+	MarkOrderNotRegistered(ctx context.Context, numOrder int64, seenAt int64, grace time.Duration) error
+	RecordOrderFailure(ctx context.Context, numOrder int64, owner string, lastErr string, maxFailures int, nextPollAt int64) (bool, error)
 }
 
+// flushTimeout bounds a batch write, which outlives shutdown.
+const flushTimeout = 5 * time.Second
+
+type pollOutcome int
+
+const (
+	outcomeUnchanged pollOutcome = iota
+	outcomeUpdated
+	outcomeThrottled
+	outcomeDeferred
+	outcomeFailed
+)
+
+// ProcessedListener is told about orders that have just reached PROCESSED.
+type ProcessedListener func(ctx context.Context, orders models.ProcessedOrderArray)
+
 type HTTPClient interface {
 	RequestAccrualOrder(ctx context.Context, urlConnect string) (*models.ResAccrualOrder, error)
 }
 type ClientAccrual struct {
 	log           *slog.Logger
 	store         StoreOrder
-	client        HTTPClient
-	urlConnect    string
+	providers     *Registry
 	chListOrders  chan *models.Order
 	chListAccrual chan *models.ResAccrualOrder
 	buffer        models.ResAccrualOrderArray
 	activeWorkers int32
+	nextWorkerID  int32
+	chStopWorker  chan struct{}
+	inFlight      sync.Map
+	lastFlushAt   atomic.Int64
 	wg            sync.WaitGroup
 	mu            sync.Mutex
 	cancel        context.CancelFunc
 	config        config.WorkerConfig
+	listeners     []ProcessedListener
+	listenersMu   sync.RWMutex
 }
 
-func New(log *slog.Logger, store StoreOrder, cfg config.WorkerConfig, client HTTPClient, urlConnect string) *ClientAccrual {
+func New(log *slog.Logger, store StoreOrder, cfg config.WorkerConfig, providers *Registry) *ClientAccrual {
 	return &ClientAccrual{
 		log:           log,
 		store:         store,
-		chListOrders:  make(chan *models.Order, cfg.CountWorkers),
+		chListOrders:  make(chan *models.Order, cfg.MaxWorkers),
+		chStopWorker:  make(chan struct{}),
 		chListAccrual: make(chan *models.ResAccrualOrder, cfg.InputChainSize),
 		buffer:        make(models.ResAccrualOrderArray, 0, cfg.BufferSize),
 		config:        cfg,
-		client:        client,
-		urlConnect:    urlConnect,
+		providers:     providers,
 	}
 }
 
@@ -54,12 +79,15 @@ func (c *ClientAccrual) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
 
+	c.wg.Add(3)
 	go c.GeneratorListOrders(ctx, c.chListOrders)
-	go c.scaleWorkers(ctx)
-
-	c.wg.Add(2)
 	go c.UpdateOrders(ctx)
 
+	for i := 0; i < c.config.MinWorkers; i++ {
+		c.addWorker(ctx)
+	}
+	go c.scaleWorkers(ctx)
+
 }
 
 func (c *ClientAccrual) Stop() {
@@ -83,7 +111,14 @@ func (c *ClientAccrual) GeneratorListOrders(ctx context.Context, chListOrders ch
 	for {
 		select {
 		case <-ticker.C:
-			orders, err := c.store.GetOrdersInWork(ctx)
+			if !c.providers.Available() {
+				continue
+			}
+			free := cap(chListOrders) - len(chListOrders)
+			if free <= 0 {
+				continue
+			}
+			orders, err := c.store.ClaimOrdersInWork(ctx, c.config.InstanceID, free, c.config.LeaseTTL, c.providers.ClaimFilter())
 			if err != nil {
 				if errors.Is(err, models.ErrOrdersInWorkIsEmpty) {
 					c.log.Info("list of orders is empty", "info", err)
@@ -104,6 +139,7 @@ func (c *ClientAccrual) GeneratorListOrders(ctx context.Context, chListOrders ch
 }
 
 func (c *ClientAccrual) scaleWorkers(ctx context.Context) {
+	defer c.wg.Done()
 	const op = "Accrual.scaleWorkers"
 
 	log := c.log.With(
@@ -112,24 +148,51 @@ func (c *ClientAccrual) scaleWorkers(ctx context.Context) {
 
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
+
+	var idleSince time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			queueLen := len(c.chListOrders)
-			activeWorkers := atomic.LoadInt32(&c.activeWorkers)
+			activeWorkers := int(atomic.LoadInt32(&c.activeWorkers))
 
-			if queueLen > 0 && activeWorkers < c.config.CountWorkers {
-				c.wg.Add(1)
-				atomic.AddInt32(&c.activeWorkers, 1)
-				go c.worker(ctx, int(activeWorkers)+1, c.chListOrders)
-				c.log.Info("Add Worker", "ID", atomic.LoadInt32(&c.activeWorkers))
+			if queueLen > 0 {
+				idleSince = time.Time{}
+				if activeWorkers < c.config.MaxWorkers {
+					c.addWorker(ctx)
+				}
+				continue
+			}
+			if activeWorkers <= c.config.MinWorkers {
+				idleSince = time.Time{}
+				continue
+			}
+			if idleSince.IsZero() {
+				idleSince = time.Now()
+				continue
+			}
+			if time.Since(idleSince) >= c.config.WorkerIdleTimeout {
+				select {
+				case c.chStopWorker <- struct{}{}:
+					log.Info("Remove Worker", "active", atomic.LoadInt32(&c.activeWorkers))
+				default:
+				}
+				idleSince = time.Now()
 			}
 		}
 	}
 }
 
+func (c *ClientAccrual) addWorker(ctx context.Context) {
+	c.wg.Add(1)
+	atomic.AddInt32(&c.activeWorkers, 1)
+	id := atomic.AddInt32(&c.nextWorkerID, 1)
+	go c.worker(ctx, int(id), c.chListOrders)
+	c.log.Info("Add Worker", "ID", id, "active", atomic.LoadInt32(&c.activeWorkers))
+}
+
 func (c *ClientAccrual) worker(ctx context.Context, id int, chOrder <-chan *models.Order) {
 	const op = "Accrual.worker"
 
@@ -149,21 +212,176 @@ func (c *ClientAccrual) worker(ctx context.Context, id int, chOrder <-chan *mode
 		select {
 		case <-ctx.Done():
 			return
+		case <-c.chStopWorker:
+			log.Info("stop idle worker")
+			return
 		case order, ok := <-chOrder:
 			if !ok {
 				return
 			}
-			url := fmt.Sprintf("%s/api/orders/%d", c.urlConnect, order.Number)
-			orderAccrual, err := c.client.RequestAccrualOrder(ctx, url)
-			if err != nil {
-				c.log.Error("failed to request accrual order", "error", err)
-				continue //return
+			provider := c.providers.Route(order)
+			c.inFlight.Store(order.Number, time.Now())
+			outcome, err := c.processOrder(ctx, provider, order)
+			c.inFlight.Delete(order.Number)
+			if ctx.Err() != nil {
+				return
 			}
-			if orderAccrual.Status != order.Status || orderAccrual.Accrual != order.Accrual {
-				c.chListAccrual <- orderAccrual
+			if outcome == outcomeFailed {
+				c.recordFailure(ctx, order, err)
+				continue
 			}
+			c.scheduleNextPoll(ctx, provider, order, outcome)
+		}
+	}
+}
+
+func (c *ClientAccrual) processOrder(ctx context.Context, provider *AccrualProvider, order *models.Order) (pollOutcome, error) {
+	if provider.PausedFor() > 0 {
+		return outcomeThrottled, nil
+	}
+	orderAccrual, err := provider.RequestAccrualOrder(ctx, order.Number)
+	if err != nil {
+		var rateErr *models.RateLimitError
+		if errors.As(err, &rateErr) {
+			provider.Pause(rateErr.RetryAfter)
+			provider.LearnRate(rateErr.RequestsPerMinute)
+			return outcomeThrottled, nil
+		}
+		if errors.Is(err, models.ErrOrderNotRegistered) {
+			c.markNotRegistered(ctx, order)
+			return outcomeUnchanged, nil
+		}
+		if errors.Is(err, models.ErrCircuitOpen) {
+			return outcomeDeferred, nil
+		}
+		c.log.Error("failed to request accrual order", "provider", provider.Name(), "error", err)
+		return outcomeFailed, err
+	}
+	status, err := models.AccrualStatusToOrder(orderAccrual.Status)
+	if err != nil {
+		c.log.Error("failed to map accrual status", "error", err)
+		return outcomeFailed, err
+	}
+	if status == order.Status && orderAccrual.Accrual == order.Accrual {
+		return outcomeUnchanged, nil
+	}
+	if !models.CanTransition(order.Status, status) {
+		c.log.Warn("rejected order status transition",
+			"number", order.Number,
+			"from", order.Status,
+			"to", status,
+			"error", models.ErrIllegalTransition,
+		)
+		return outcomeUnchanged, nil
+	}
+	orderAccrual.Status = status
+	select {
+	case c.chListAccrual <- orderAccrual:
+	case <-ctx.Done():
+		return outcomeFailed, ctx.Err()
+	}
+	return outcomeUpdated, nil
+}
+
+func (c *ClientAccrual) recordFailure(ctx context.Context, order *models.Order, cause error) {
+	const op = "Accrual.recordFailure"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprint(order.Number)),
+	)
+
+	nextPollAt := time.Now().Add(c.nextPollDelay(order.Attempts + 1))
+	deadLettered, err := c.store.RecordOrderFailure(ctx, order.Number, c.config.InstanceID, cause.Error(),
+		c.config.MaxFailures, nextPollAt.Unix())
+	if err != nil {
+		log.Error("failed to record order failure", "error", err)
+		return
+	}
+	if deadLettered {
+		log.Warn("order moved to dead letter queue", "error", cause)
+	}
+}
+
+func (c *ClientAccrual) scheduleNextPoll(ctx context.Context, provider *AccrualProvider, order *models.Order, outcome pollOutcome) {
+	const op = "Accrual.scheduleNextPoll"
+
+	attempts := order.Attempts
+	var nextPollAt time.Time
+	switch outcome {
+	case outcomeUpdated:
+		attempts = 0
+		nextPollAt = time.Now().Add(c.nextPollDelay(attempts))
+	case outcomeThrottled, outcomeDeferred:
+		nextPollAt = provider.ResumeAt()
+		if nextPollAt.Before(time.Now()) {
+			nextPollAt = time.Now().Add(c.config.PollBaseDelay)
+		}
+	default:
+		attempts++
+		nextPollAt = time.Now().Add(c.nextPollDelay(attempts))
+	}
+
+	if err := c.store.RescheduleOrder(ctx, order.Number, c.config.InstanceID, attempts, nextPollAt.Unix()); err != nil {
+		c.log.Error("failed to reschedule order", "op", op, "number", order.Number, "error", err)
+	}
+}
+
+func (c *ClientAccrual) nextPollDelay(attempts int) time.Duration {
+	delay := c.config.PollBaseDelay
+	for i := 0; i < attempts && delay < c.config.PollMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.config.PollMaxDelay {
+		delay = c.config.PollMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (c *ClientAccrual) markNotRegistered(ctx context.Context, order *models.Order) {
+	const op = "Accrual.markNotRegistered"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprint(order.Number)),
+	)
+
+	err := c.store.MarkOrderNotRegistered(ctx, order.Number, time.Now().Unix(), c.config.NotRegisteredGrace)
+	if err != nil {
+		log.Error("failed to mark order as not registered", "error", err)
+		return
+	}
+	log.Info("order is not registered in accrual system")
+}
+
+func (c *ClientAccrual) Push(ctx context.Context, orders models.ResAccrualOrderArray) error {
+	const op = "Accrual.Push"
+
+	log := c.log.With(
+		slog.String("op", op))
+	log.Info("push accrual orders", "count", len(orders))
+
+	statuses := make([]string, len(orders))
+	for i, order := range orders {
+		status, err := models.AccrualStatusToOrder(order.Status)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
 		}
+		statuses[i] = status
 	}
+
+	for i, order := range orders {
+		order.Status = statuses[i]
+		select {
+		case c.chListAccrual <- order:
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+	}
+	return nil
 }
 
 func (c *ClientAccrual) UpdateOrders(ctx context.Context) {
@@ -181,6 +399,7 @@ func (c *ClientAccrual) UpdateOrders(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			c.drainQueue()
 			c.flushBuffer(ctx)
 			return
 
@@ -206,11 +425,28 @@ func (c *ClientAccrual) addToBuffer(ctx context.Context, task *models.ResAccrual
 	c.buffer = append(c.buffer, task)
 
 	if len(c.buffer) >= c.config.BatchSize {
+		c.wg.Add(1)
 		go c.flushBufferAsync(ctx, c.getBufferCopy())
 		c.buffer = c.buffer[:0]
 	}
 }
 
+// drainQueue moves whatever is still queued into the buffer on shutdown. Push
+// has already acknowledged those updates, so they must reach the final flush.
+func (c *ClientAccrual) drainQueue() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		select {
+		case task := <-c.chListAccrual:
+			c.buffer = append(c.buffer, task)
+		default:
+			return
+		}
+	}
+}
+
 func (c *ClientAccrual) flushBuffer(ctx context.Context) {
 	const op = "Accrual.flushBuffer"
 
@@ -266,14 +502,13 @@ func (c *ClientAccrual) getBufferCopy() models.ResAccrualOrderArray {
 }
 
 func (c *ClientAccrual) flushBufferAsync(ctx context.Context, batch models.ResAccrualOrderArray) {
+	defer c.wg.Done()
 	const op = "Accrual.flushBufferAsync"
 
 	log := c.log.With(
 		slog.String("op", op))
 	log.Info("start flushBufferAsync")
 
-	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
-	defer cancel()
 	c.processBatch(ctx, batch)
 }
 
@@ -283,12 +518,65 @@ func (c *ClientAccrual) processBatch(ctx context.Context, batch models.ResAccrua
 	log := c.log.With(
 		slog.String("op", op))
 	log.Info("start processBatch - UpdateOrdersBatch")
-	if err := c.store.UpdateOrdersBatch(ctx, batch); err != nil {
+
+	// The updates in a batch have already been acknowledged, so shutdown must
+	// not cut the write short; only the timeout bounds it.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+	defer cancel()
+
+	c.lastFlushAt.Store(time.Now().UnixNano())
+	processed, err := c.store.UpdateOrdersBatch(ctx, batch)
+	if err != nil {
 		c.log.Error("Batch processing failed",
 			"error", err,
 			"batch_size", len(batch))
-	} else {
-		c.log.Info("Batch processed successfully",
-			"batch_size", len(batch))
+		return
+	}
+	c.log.Info("Batch processed successfully",
+		"batch_size", len(batch))
+
+	if len(processed) == 0 {
+		return
+	}
+	c.listenersMu.RLock()
+	listeners := c.listeners
+	c.listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(ctx, processed)
+	}
+}
+
+func (c *ClientAccrual) Subscribe(listener ProcessedListener) {
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *ClientAccrual) Stats() models.PoolStats {
+	c.mu.Lock()
+	bufferSize := len(c.buffer)
+	c.mu.Unlock()
+
+	stats := models.PoolStats{
+		ActiveWorkers: int(atomic.LoadInt32(&c.activeWorkers)),
+		MinWorkers:    c.config.MinWorkers,
+		MaxWorkers:    c.config.MaxWorkers,
+		QueueDepth:    len(c.chListOrders),
+		QueueCapacity: cap(c.chListOrders),
+		BufferSize:    bufferSize,
+		BatchSize:     c.config.BatchSize,
+		Providers:     c.providers.Stats(),
+		InFlight:      models.InFlightOrderArray{},
+	}
+	if lastFlush := c.lastFlushAt.Load(); lastFlush > 0 {
+		stats.LastFlushAt = time.Unix(0, lastFlush)
 	}
+	c.inFlight.Range(func(key, value any) bool {
+		stats.InFlight = append(stats.InFlight, models.InFlightOrder{
+			Number: key.(int64),
+			Since:  value.(time.Time),
+		})
+		return true
+	})
+	return stats
 }
@@ -0,0 +1,180 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/storage/memory"
+)
+
+func TestGeneratorSkipsOrdersOfPausedProvider(t *testing.T) {
+	store := memory.NewMemoryStore(0)
+	ctx := context.Background()
+	for _, number := range []int64{9001, 9002, 1001} {
+		if err := store.AddOrder(ctx, number, time.Now().Unix(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testWorkerConfig()
+	cfg.MaxWorkers = 10
+	registry := newTestRegistry(t)
+	registry.providers["partner"].Pause(time.Minute)
+	c := New(testLogger(), store, cfg, registry)
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.wg.Add(1)
+	go c.GeneratorListOrders(ctx, c.chListOrders)
+
+	select {
+	case order := <-c.chListOrders:
+		if order.Number != 1001 {
+			t.Fatalf("claimed order: got %d, want 1001", order.Number)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no order claimed")
+	}
+	time.Sleep(700 * time.Millisecond)
+	cancel()
+	c.wg.Wait()
+
+	for order := range c.chListOrders {
+		t.Errorf("claimed order of paused provider: %d", order.Number)
+	}
+	claimed, err := store.ClaimOrdersInWork(context.Background(), "other", 10, time.Minute, models.ClaimFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("orders left unleased: got %+v", claimed)
+	}
+}
+
+func TestScaleWorkersShrinksIdlePoolToMin(t *testing.T) {
+	cfg := testWorkerConfig()
+	cfg.MinWorkers = 1
+	cfg.MaxWorkers = 3
+	cfg.WorkerIdleTimeout = 100 * time.Millisecond
+	c := New(testLogger(), memory.NewMemoryStore(0), cfg, newTestRegistry(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		c.wg.Wait()
+	}()
+	for i := 0; i < cfg.MaxWorkers; i++ {
+		c.addWorker(ctx)
+	}
+	c.wg.Add(1)
+	go c.scaleWorkers(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().ActiveWorkers > cfg.MinWorkers && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := c.Stats().ActiveWorkers; got != cfg.MinWorkers {
+		t.Fatalf("active workers: got %d, want %d", got, cfg.MinWorkers)
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+	if got := c.Stats().ActiveWorkers; got != cfg.MinWorkers {
+		t.Fatalf("pool shrank below min: got %d workers", got)
+	}
+}
+
+func TestProcessOrderGivesUpOnFullQueueAtShutdown(t *testing.T) {
+	cfg := testWorkerConfig()
+	cfg.InputChainSize = 0
+	registry, err := NewRegistry(testLogger(), cfg, func(time.Duration) HTTPClient {
+		return &stubClient{res: &models.ResAccrualOrder{OrderNum: 79927398713, Status: "PROCESSED", Accrual: 500}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(testLogger(), memory.NewMemoryStore(0), cfg, registry)
+	order := &models.Order{Number: 79927398713, Status: models.StatusNew}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.processOrder(ctx, registry.Route(order), order)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("processOrder: got %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("processOrder blocked on the accrual queue after shutdown")
+	}
+}
+
+func TestStopFlushesAcknowledgedUpdates(t *testing.T) {
+	store := memory.NewMemoryStore(0)
+	numbers := []int64{12345678903, 79927398713, 4561261212345467}
+	for _, number := range numbers {
+		if err := store.AddOrder(context.Background(), number, time.Now().Unix(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := testWorkerConfig()
+	cfg.InputChainSize = len(numbers)
+	cfg.BatchSize = 10
+	c := New(testLogger(), store, cfg, newTestRegistry(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	var pushed models.ResAccrualOrderArray
+	for _, number := range numbers {
+		pushed = append(pushed, &models.ResAccrualOrder{OrderNum: number, Status: "PROCESSED", Accrual: 100})
+	}
+	if err := c.Push(ctx, pushed); err != nil {
+		t.Fatal(err)
+	}
+	c.wg.Add(1)
+	go c.UpdateOrders(ctx)
+	c.Stop()
+
+	orders, err := store.GetOrder(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, order := range orders {
+		if order.Status != models.StatusProcessed {
+			t.Errorf("order %d: got %s, want %s after shutdown", order.Number, order.Status, models.StatusProcessed)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	cfg := testWorkerConfig()
+	cfg.BatchSize = 10
+	c := New(testLogger(), memory.NewMemoryStore(0), cfg, newTestRegistry(t))
+
+	stats := c.Stats()
+	if stats.ActiveWorkers != 0 || stats.MinWorkers != 1 || stats.MaxWorkers != 2 ||
+		stats.QueueCapacity != 2 || stats.QueueDepth != 0 || stats.BatchSize != 10 ||
+		!stats.LastFlushAt.IsZero() || len(stats.InFlight) != 0 || len(stats.Providers) != 2 {
+		t.Fatalf("idle stats: got %+v", stats)
+	}
+
+	since := time.Now().Add(-time.Second)
+	c.inFlight.Store(int64(12345678903), since)
+	c.chListOrders <- &models.Order{Number: 79927398713}
+	c.buffer = append(c.buffer, &models.ResAccrualOrder{OrderNum: 2377225624})
+	flushed := time.Now()
+	c.lastFlushAt.Store(flushed.UnixNano())
+
+	stats = c.Stats()
+	if stats.QueueDepth != 1 || stats.BufferSize != 1 || !stats.LastFlushAt.Equal(time.Unix(0, flushed.UnixNano())) {
+		t.Fatalf("busy stats: got %+v", stats)
+	}
+	if len(stats.InFlight) != 1 || stats.InFlight[0].Number != 12345678903 || !stats.InFlight[0].Since.Equal(since) {
+		t.Fatalf("in flight: got %+v", stats.InFlight)
+	}
+}
@@ -0,0 +1,35 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ArtShib/gophermart.git/internal/lib/breaker"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type breakerClient struct {
+	client  HTTPClient
+	breaker *breaker.Breaker
+}
+
+func (b *breakerClient) RequestAccrualOrder(ctx context.Context, urlConnect string) (*models.ResAccrualOrder, error) {
+	const op = "Accrual.breakerClient.RequestAccrualOrder"
+
+	if !b.breaker.Allow() {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrCircuitOpen)
+	}
+	res, err := b.client.RequestAccrualOrder(ctx, urlConnect)
+	switch {
+	case err == nil:
+		b.breaker.Success()
+	case ctx.Err() != nil:
+		b.breaker.Release()
+	case errors.Is(err, models.ErrAccrualUnavailable):
+		b.breaker.Failure()
+	default:
+		b.breaker.Success()
+	}
+	return res, err
+}
@@ -0,0 +1,67 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/lib/breaker"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type blockingClient struct{}
+
+func (blockingClient) RequestAccrualOrder(ctx context.Context, urlConnect string) (*models.ResAccrualOrder, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestBreakerClientCancelledProbeKeepsHalfOpen(t *testing.T) {
+	b := breaker.New(1, 10*time.Millisecond, 1, nil)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+	if state := b.State(); state != breaker.StateHalfOpen {
+		t.Fatalf("state: got %s, want half-open", state)
+	}
+
+	client := &breakerClient{client: blockingClient{}, breaker: b}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.RequestAccrualOrder(ctx, "http://accrual"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled probe: got %v", err)
+	}
+	if state := b.State(); state != breaker.StateHalfOpen {
+		t.Fatalf("state after cancelled probe: got %s, want half-open", state)
+	}
+	if !b.Allow() {
+		t.Fatal("cancelled probe did not free its slot")
+	}
+}
+
+func TestBreakerClientOutcomes(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want breaker.State
+	}{
+		{name: "unavailable trips", err: models.ErrAccrualUnavailable, want: breaker.StateOpen},
+		{name: "not registered is a healthy answer", err: models.ErrOrderNotRegistered, want: breaker.StateClosed},
+		{name: "success", want: breaker.StateClosed},
+	}
+	for _, tt := range tests {
+		b := breaker.New(1, time.Minute, 1, nil)
+		client := &breakerClient{client: &stubClient{err: tt.err}, breaker: b}
+		client.RequestAccrualOrder(context.Background(), "http://accrual")
+		if state := b.State(); state != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, state, tt.want)
+		}
+	}
+
+	b := breaker.New(1, time.Minute, 1, nil)
+	b.Failure()
+	client := &breakerClient{client: &stubClient{}, breaker: b}
+	if _, err := client.RequestAccrualOrder(context.Background(), "http://accrual"); !errors.Is(err, models.ErrCircuitOpen) {
+		t.Errorf("open breaker: got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package accrual
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/lib/breaker"
+	"github.com/ArtShib/gophermart.git/internal/lib/ratelimit"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+const numberPlaceholder = "{number}"
+
+type AccrualProvider struct {
+	name         string
+	baseURL      string
+	pathTemplate string
+	log          *slog.Logger
+	client       HTTPClient
+	breaker      *breaker.Breaker
+	limiter      *ratelimit.Limiter
+	pauseUntil   atomic.Int64
+}
+
+func NewProvider(log *slog.Logger, cfg config.ProviderConfig, workerCfg config.WorkerConfig, client HTTPClient) *AccrualProvider {
+	p := &AccrualProvider{
+		name:         cfg.Name,
+		baseURL:      strings.TrimRight(cfg.URL, "/"),
+		pathTemplate: cfg.Path,
+		log:          log.With(slog.String("provider", cfg.Name)),
+		limiter:      ratelimit.New(cfg.RateLimit, cfg.RateBurst),
+	}
+	p.breaker = breaker.New(workerCfg.BreakerFailures, workerCfg.BreakerOpenTimeout, workerCfg.BreakerHalfOpen, p.breakerStateChanged)
+	p.client = &breakerClient{client: client, breaker: p.breaker}
+	return p
+}
+
+func (p *AccrualProvider) Name() string {
+	return p.name
+}
+
+func (p *AccrualProvider) URL(numOrder int64) string {
+	return p.baseURL + strings.ReplaceAll(p.pathTemplate, numberPlaceholder, strconv.FormatInt(numOrder, 10))
+}
+
+func (p *AccrualProvider) RequestAccrualOrder(ctx context.Context, numOrder int64) (*models.ResAccrualOrder, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return p.client.RequestAccrualOrder(ctx, p.URL(numOrder))
+}
+
+func (p *AccrualProvider) Available() bool {
+	return p.PausedFor() <= 0 && p.breaker.Ready()
+}
+
+func (p *AccrualProvider) ResumeAt() time.Time {
+	resumeAt := time.Unix(0, p.pauseUntil.Load())
+	if openUntil := p.breaker.OpenUntil(); openUntil.After(resumeAt) {
+		resumeAt = openUntil
+	}
+	return resumeAt
+}
+
+func (p *AccrualProvider) Pause(d time.Duration) {
+	const op = "Accrual.Provider.Pause"
+
+	until := time.Now().Add(d).UnixNano()
+	for {
+		current := p.pauseUntil.Load()
+		if current >= until {
+			return
+		}
+		if p.pauseUntil.CompareAndSwap(current, until) {
+			p.log.Warn("accrual system is throttling requests, provider paused",
+				"op", op,
+				"retry_after", d,
+			)
+			return
+		}
+	}
+}
+
+func (p *AccrualProvider) PausedFor() time.Duration {
+	return time.Until(time.Unix(0, p.pauseUntil.Load()))
+}
+
+func (p *AccrualProvider) LearnRate(requestsPerMinute int) {
+	const op = "Accrual.Provider.LearnRate"
+
+	if requestsPerMinute <= 0 {
+		return
+	}
+	rate := float64(requestsPerMinute) / 60
+	if p.limiter.Rate() == rate {
+		return
+	}
+	p.limiter.SetRate(rate)
+	p.log.Info("accrual rate limit adjusted",
+		"op", op,
+		"requests_per_minute", requestsPerMinute,
+	)
+}
+
+func (p *AccrualProvider) Stats() models.ProviderStats {
+	stats := models.ProviderStats{
+		Name:      p.name,
+		URL:       p.baseURL + p.pathTemplate,
+		Breaker:   p.breaker.State().String(),
+		RateLimit: p.limiter.Rate(),
+	}
+	if pausedFor := p.PausedFor(); pausedFor > 0 {
+		stats.PausedUntil = time.Now().Add(pausedFor)
+	}
+	return stats
+}
+
+func (p *AccrualProvider) breakerStateChanged(from, to breaker.State) {
+	p.log.Warn("accrual circuit breaker state changed",
+		"op", "Accrual.Provider.breakerStateChanged",
+		"from", from.String(),
+		"to", to.String(),
+	)
+}
+
+type route struct {
+	provider string
+	rule     models.ClaimRoute
+}
+
+type Registry struct {
+	providers map[string]*AccrualProvider
+	order     []string
+	routes    []route
+	fallback  string
+}
+
+func NewRegistry(log *slog.Logger, cfg config.WorkerConfig, newClient func(timeout time.Duration) HTTPClient) (*Registry, error) {
+	const op = "Accrual.NewRegistry"
+
+	r := &Registry{
+		providers: make(map[string]*AccrualProvider, len(cfg.Providers)),
+		fallback:  cfg.DefaultProvider,
+	}
+	for _, providerCfg := range cfg.Providers {
+		if _, ok := r.providers[providerCfg.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate provider %q", op, providerCfg.Name)
+		}
+		r.providers[providerCfg.Name] = NewProvider(log, providerCfg, cfg, newClient(providerCfg.Timeout))
+		r.order = append(r.order, providerCfg.Name)
+	}
+	if _, ok := r.providers[r.fallback]; !ok {
+		return nil, fmt.Errorf("%s: unknown default provider %q", op, r.fallback)
+	}
+	for _, routeCfg := range cfg.Routes {
+		if _, ok := r.providers[routeCfg.Provider]; !ok {
+			return nil, fmt.Errorf("%s: route to unknown provider %q", op, routeCfg.Provider)
+		}
+		rt := route{
+			provider: routeCfg.Provider,
+			rule:     models.ClaimRoute{Prefix: routeCfg.Prefix, UserIDs: routeCfg.UserIDs},
+		}
+		r.routes = append(r.routes, rt)
+	}
+	return r, nil
+}
+
+func (r *Registry) Route(order *models.Order) *AccrualProvider {
+	for _, rt := range r.routes {
+		if rt.rule.Match(order.Number, order.UserID) {
+			return r.providers[rt.provider]
+		}
+	}
+	return r.providers[r.fallback]
+}
+
+func (r *Registry) Available() bool {
+	for _, p := range r.providers {
+		if p.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimFilter skips orders that would be routed to a paused or open provider,
+// so they stay unleased until the provider is back.
+func (r *Registry) ClaimFilter() models.ClaimFilter {
+	filter := models.ClaimFilter{
+		Routes:      make([]models.ClaimRoute, 0, len(r.routes)),
+		SkipDefault: !r.providers[r.fallback].Available(),
+	}
+	for _, rt := range r.routes {
+		rule := rt.rule
+		rule.Skip = !r.providers[rt.provider].Available()
+		filter.Routes = append(filter.Routes, rule)
+	}
+	return filter
+}
+
+func (r *Registry) Stats() []models.ProviderStats {
+	stats := make([]models.ProviderStats, 0, len(r.order))
+	for _, name := range r.order {
+		stats = append(stats, r.providers[name].Stats())
+	}
+	return stats
+}
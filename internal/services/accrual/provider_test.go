@@ -0,0 +1,143 @@
+package accrual
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type stubClient struct {
+	res *models.ResAccrualOrder
+	err error
+}
+
+func (s *stubClient) RequestAccrualOrder(ctx context.Context, urlConnect string) (*models.ResAccrualOrder, error) {
+	return s.res, s.err
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testWorkerConfig() config.WorkerConfig {
+	return config.WorkerConfig{
+		MinWorkers:         1,
+		MaxWorkers:         2,
+		InstanceID:         "test",
+		LeaseTTL:           time.Minute,
+		BreakerFailures:    3,
+		BreakerOpenTimeout: time.Minute,
+		BreakerHalfOpen:    1,
+		DefaultProvider:    config.DefaultProviderName,
+		Providers: []config.ProviderConfig{
+			{Name: config.DefaultProviderName, URL: "http://default", Path: config.DefaultProviderPath},
+			{Name: "partner", URL: "http://partner", Path: "/orders/{number}"},
+		},
+		Routes: []config.RouteConfig{
+			{Provider: "partner", Prefix: "9"},
+			{Provider: config.DefaultProviderName, UserIDs: []int64{7}},
+			{Provider: "partner", UserIDs: []int64{42}},
+		},
+	}
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+
+	registry, err := NewRegistry(testLogger(), testWorkerConfig(), func(time.Duration) HTTPClient {
+		return &stubClient{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestRegistryRoute(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		number int64
+		userID int64
+		want   string
+	}{
+		{number: 9001, userID: 1, want: "partner"},
+		{number: 1001, userID: 1, want: config.DefaultProviderName},
+		{number: 1001, userID: 42, want: "partner"},
+		{number: 1001, userID: 7, want: config.DefaultProviderName},
+		{number: 9001, userID: 7, want: "partner"},
+	}
+	for _, tt := range tests {
+		got := registry.Route(&models.Order{Number: tt.number, UserID: tt.userID})
+		if got.Name() != tt.want {
+			t.Errorf("route %d for user %d: got %s, want %s", tt.number, tt.userID, got.Name(), tt.want)
+		}
+	}
+	if url := registry.providers["partner"].URL(9001); url != "http://partner/orders/9001" {
+		t.Errorf("partner url: got %s", url)
+	}
+}
+
+func TestNewRegistryRejectsUnknownProviders(t *testing.T) {
+	newClient := func(time.Duration) HTTPClient { return &stubClient{} }
+
+	cfg := testWorkerConfig()
+	cfg.DefaultProvider = "missing"
+	if _, err := NewRegistry(testLogger(), cfg, newClient); err == nil {
+		t.Error("unknown default provider: want error")
+	}
+
+	cfg = testWorkerConfig()
+	cfg.Routes = append(cfg.Routes, config.RouteConfig{Provider: "missing"})
+	if _, err := NewRegistry(testLogger(), cfg, newClient); err == nil {
+		t.Error("route to unknown provider: want error")
+	}
+
+	cfg = testWorkerConfig()
+	cfg.Providers = append(cfg.Providers, cfg.Providers[0])
+	if _, err := NewRegistry(testLogger(), cfg, newClient); err == nil {
+		t.Error("duplicate provider: want error")
+	}
+}
+
+func TestRegistryClaimFilterSkipsPausedProvider(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	if filter := registry.ClaimFilter(); !filter.SkipsNone() {
+		t.Fatalf("no provider paused: got %+v", filter)
+	}
+
+	registry.providers["partner"].Pause(time.Minute)
+	filter := registry.ClaimFilter()
+	tests := []struct {
+		number int64
+		userID int64
+		want   bool
+	}{
+		{number: 9001, userID: 1, want: true},
+		{number: 1001, userID: 42, want: true},
+		{number: 1001, userID: 1, want: false},
+		{number: 1001, userID: 7, want: false},
+	}
+	for _, tt := range tests {
+		if got := filter.Skips(tt.number, tt.userID); got != tt.want {
+			t.Errorf("skip %d for user %d: got %v, want %v", tt.number, tt.userID, got, tt.want)
+		}
+	}
+	if !registry.Available() {
+		t.Error("registry with a live default provider: want available")
+	}
+
+	registry.providers[config.DefaultProviderName].Pause(time.Minute)
+	if filter := registry.ClaimFilter(); !filter.Skips(1001, 1) || !filter.Skips(1001, 7) {
+		t.Errorf("default provider paused: got %+v", filter)
+	}
+	if registry.Available() {
+		t.Error("all providers paused: want unavailable")
+	}
+}
@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base32"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/ArtShib/gophermart.git/internal/lib/jwt"
@@ -13,8 +16,9 @@ import (
 )
 
 type StoreUser interface {
-	SaveUser(ctx context.Context, login string, passHash []byte) (*models.User, error)
+	SaveUser(ctx context.Context, login string, passHash []byte, referralCode string, referredBy int64) (*models.User, error)
 	User(ctx context.Context, login string) (*models.User, error)
+	UserByReferralCode(ctx context.Context, code string) (*models.User, error)
 }
 
 type Auth struct {
@@ -43,7 +47,7 @@ func (a *Auth) Login(ctx context.Context, login string, password string, secretK
 	user, err := a.store.User(ctx, login)
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
-			a.log.Warn("user not found", err)
+			a.log.Warn("user not found", "error", err)
 
 			return "", fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
 		}
@@ -68,7 +72,7 @@ func (a *Auth) Login(ctx context.Context, login string, password string, secretK
 	return token, nil
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, login string, pass string, secretKey []byte) (string, error) {
+func (a *Auth) RegisterNewUser(ctx context.Context, login string, pass string, referralCode string, secretKey []byte) (string, error) {
 	const op = "Auth.RegisterNewUser"
 
 	log := a.log.With(
@@ -83,10 +87,34 @@ func (a *Auth) RegisterNewUser(ctx context.Context, login string, pass string, s
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	user, err := a.store.SaveUser(ctx, login, passHash)
-	if err != nil {
-		a.log.Error("failed to save user", "error", err)
-		return "", fmt.Errorf("%s: %w", op, err)
+	var referredBy int64
+	if code := strings.ToUpper(strings.TrimSpace(referralCode)); code != "" {
+		referrer, err := a.store.UserByReferralCode(ctx, code)
+		if err != nil {
+			a.log.Warn("failed to resolve referral code", "error", err)
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		referredBy = referrer.ID
+	}
+
+	var user *models.User
+	for attempt := 1; ; attempt++ {
+		ownCode, err := newReferralCode()
+		if err != nil {
+			a.log.Error("failed to generate referral code", "error", err)
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		user, err = a.store.SaveUser(ctx, login, passHash, ownCode, referredBy)
+		if errors.Is(err, models.ErrReferralCodeTaken) && attempt < referralCodeAttempts {
+			a.log.Warn("referral code collision, generating another", "error", err)
+			continue
+		}
+		if err != nil {
+			a.log.Error("failed to save user", "error", err)
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		break
 	}
 
 	token, err := jwt.NewToken(user, a.tokenTTL, secretKey)
@@ -99,6 +127,18 @@ func (a *Auth) RegisterNewUser(ctx context.Context, login string, pass string, s
 	return token, nil
 }
 
+// referralCodeAttempts bounds how many fresh codes registration tries before
+// giving up on a run of collisions.
+const referralCodeAttempts = 5
+
+func newReferralCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(buf), nil
+}
+
 func (a *Auth) ParseToken(tokenString string, secretKey []byte) (int64, error) {
 	const op = "Auth.ParseToken"
 
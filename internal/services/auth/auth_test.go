@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type collidingStore struct {
+	collisions int
+	codes      []string
+}
+
+func (s *collidingStore) SaveUser(ctx context.Context, login string, passHash []byte, referralCode string, referredBy int64) (*models.User, error) {
+	s.codes = append(s.codes, referralCode)
+	if len(s.codes) <= s.collisions {
+		return nil, models.ErrReferralCodeTaken
+	}
+	return &models.User{ID: 1, Login: login, ReferralCode: referralCode}, nil
+}
+
+func (s *collidingStore) User(ctx context.Context, login string) (*models.User, error) {
+	return nil, models.ErrUserNotFound
+}
+
+func (s *collidingStore) UserByReferralCode(ctx context.Context, code string) (*models.User, error) {
+	return nil, models.ErrInvalidReferralCode
+}
+
+func newAuth(store StoreUser) *Auth {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, time.Minute)
+}
+
+func TestRegisterRetriesReferralCodeCollisions(t *testing.T) {
+	store := &collidingStore{collisions: 2}
+	if _, err := newAuth(store).RegisterNewUser(context.Background(), "alice", "secret", "", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.codes) != 3 || store.codes[0] == store.codes[2] {
+		t.Fatalf("codes tried: got %v", store.codes)
+	}
+}
+
+func TestRegisterGivesUpAfterRepeatedCollisions(t *testing.T) {
+	store := &collidingStore{collisions: referralCodeAttempts}
+	_, err := newAuth(store).RegisterNewUser(context.Background(), "alice", "secret", "", []byte("key"))
+	if !errors.Is(err, models.ErrReferralCodeTaken) || errors.Is(err, models.ErrUserExists) {
+		t.Fatalf("got %v, want ErrReferralCodeTaken", err)
+	}
+	if len(store.codes) != referralCodeAttempts {
+		t.Fatalf("attempts: got %d, want %d", len(store.codes), referralCodeAttempts)
+	}
+}
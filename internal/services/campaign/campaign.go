@@ -0,0 +1,129 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreCampaign interface {
+	UserByID(ctx context.Context, userID int64) (*models.User, error)
+	AddOrderBonus(ctx context.Context, numOrder int64, userID int64, bonuses models.OrderBonusArray, created int64) error
+}
+
+type TierResolver interface {
+	TierAt(lifetime models.Money) string
+}
+
+type Campaign struct {
+	log       *slog.Logger
+	store     StoreCampaign
+	tiers     TierResolver
+	campaigns models.CampaignArray
+}
+
+func New(log *slog.Logger, store StoreCampaign, tiers TierResolver, cfg config.CampaignsConfig) (*Campaign, error) {
+	const op = "Campaign.New"
+
+	campaigns := make(models.CampaignArray, 0, len(cfg.Campaigns))
+	names := make(map[string]struct{}, len(cfg.Campaigns))
+	for _, cc := range cfg.Campaigns {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("%s: campaign name is required", op)
+		}
+		if _, ok := names[cc.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate campaign %q", op, cc.Name)
+		}
+		names[cc.Name] = struct{}{}
+
+		campaign := models.Campaign{
+			Name:           cc.Name,
+			NewUsersWithin: cc.NewUsersWithin,
+			Tiers:          cc.Tiers,
+			MinOrders:      cc.MinOrders,
+			MaxOrders:      cc.MaxOrders,
+			Stackable:      cc.Stackable,
+		}
+		if !cc.StartsAt.IsZero() {
+			campaign.StartsAt = cc.StartsAt.Unix()
+		}
+		if !cc.EndsAt.IsZero() {
+			campaign.EndsAt = cc.EndsAt.Unix()
+		}
+		if campaign.StartsAt != 0 && campaign.EndsAt != 0 && campaign.EndsAt <= campaign.StartsAt {
+			return nil, fmt.Errorf("%s: campaign %q ends before it starts", op, cc.Name)
+		}
+
+		var err error
+		if cc.Multiplier != "" {
+			if campaign.Multiplier, err = models.ParseMoney(cc.Multiplier.String()); err != nil {
+				return nil, fmt.Errorf("%s: campaign %q: %w", op, cc.Name, err)
+			}
+		}
+		if cc.Bonus != "" {
+			if campaign.Bonus, err = models.ParseMoney(cc.Bonus.String()); err != nil {
+				return nil, fmt.Errorf("%s: campaign %q: %w", op, cc.Name, err)
+			}
+		}
+		if campaign.Multiplier <= 100 && campaign.Bonus <= 0 {
+			return nil, fmt.Errorf("%s: campaign %q needs a multiplier above 1 or a positive bonus", op, cc.Name)
+		}
+		campaigns = append(campaigns, campaign)
+	}
+
+	return &Campaign{
+		log:       log,
+		store:     store,
+		tiers:     tiers,
+		campaigns: campaigns,
+	}, nil
+}
+
+// OnProcessed credits campaign bonuses for an order that has reached PROCESSED.
+// It is an outbox handler: an order already credited counts as done.
+func (c *Campaign) OnProcessed(ctx context.Context, order models.ProcessedOrder) error {
+	if len(c.campaigns) == 0 {
+		return nil
+	}
+	if err := c.Apply(ctx, order, time.Now().Unix()); err != nil && !errors.Is(err, models.ErrBonusApplied) {
+		return err
+	}
+	return nil
+}
+
+// Apply judges the order as it stood when it was processed: the campaign
+// window, the account age, the order's position and the tier all use that
+// moment, as recorded with the PROCESSED transition.
+func (c *Campaign) Apply(ctx context.Context, order models.ProcessedOrder, now int64) error {
+	const op = "Campaign.Apply"
+
+	user, err := c.store.UserByID(ctx, order.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	bonuses := c.campaigns.Apply(models.CampaignSubject{
+		Accrual:      order.Accrual,
+		ProcessedAt:  order.ProcessedAt,
+		RegisteredAt: user.CreatedAt,
+		Tier:         c.tiers.TierAt(order.LifetimeAccrual),
+		OrderCount:   order.Position,
+	})
+	if len(bonuses) == 0 {
+		return nil
+	}
+	if err := c.store.AddOrderBonus(ctx, order.OrderNum, order.UserID, bonuses, now); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	c.log.Info("campaign bonus credited",
+		slog.String("op", op),
+		slog.Int64("number", order.OrderNum),
+		slog.String("bonus", bonuses.Total().String()))
+	return nil
+}
@@ -0,0 +1,58 @@
+package campaign
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/services/tier"
+)
+
+type stubStore struct {
+	bonuses map[int64]models.OrderBonusArray
+}
+
+func (s *stubStore) UserByID(ctx context.Context, userID int64) (*models.User, error) {
+	return &models.User{ID: userID}, nil
+}
+
+func (s *stubStore) AddOrderBonus(ctx context.Context, numOrder int64, userID int64, bonuses models.OrderBonusArray, created int64) error {
+	s.bonuses[numOrder] = bonuses
+	return nil
+}
+
+func TestApplyJudgesTheTierTheOrderWasEarnedIn(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tiers, err := tier.New(log, nil, config.TiersConfig{Tiers: config.DefaultTiers()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &stubStore{bonuses: map[int64]models.OrderBonusArray{}}
+	c, err := New(log, store, tiers, config.CampaignsConfig{Campaigns: []config.CampaignConfig{
+		{Name: "gold-only", Multiplier: "2", Tiers: []string{"gold"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	silver := models.ProcessedOrder{OrderNum: 12345678903, UserID: 1, Accrual: 10000, ProcessedAt: now, Position: 1, LifetimeAccrual: 100000}
+	gold := models.ProcessedOrder{OrderNum: 79927398713, UserID: 1, Accrual: 10000, ProcessedAt: now, Position: 2, LifetimeAccrual: 500000}
+	for _, order := range []models.ProcessedOrder{gold, silver} {
+		if err := c.Apply(ctx, order, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if bonuses, ok := store.bonuses[silver.OrderNum]; ok {
+		t.Fatalf("order earned in silver got a gold bonus: %+v", bonuses)
+	}
+	if bonuses := store.bonuses[gold.OrderNum]; bonuses.Total() != 10000 {
+		t.Fatalf("order earned in gold: got %+v", bonuses)
+	}
+}
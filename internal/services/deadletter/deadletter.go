@@ -0,0 +1,66 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreDeadLetter interface {
+	GetDeadLetterOrders(ctx context.Context) (models.DeadLetterOrderArray, error)
+	GetDeadLetterOrder(ctx context.Context, numOrder int64) (*models.DeadLetterOrder, error)
+	RequeueDeadLetterOrder(ctx context.Context, numOrder int64) error
+}
+
+type DeadLetter struct {
+	log   *slog.Logger
+	store StoreDeadLetter
+}
+
+func New(log *slog.Logger, store StoreDeadLetter) *DeadLetter {
+	return &DeadLetter{
+		log:   log,
+		store: store,
+	}
+}
+
+func (d *DeadLetter) List(ctx context.Context) (models.DeadLetterOrderArray, error) {
+	const op = "DeadLetter.List"
+
+	log := d.log.With(
+		slog.String("op", op))
+
+	log.Info("list dead-lettered orders")
+
+	return d.store.GetDeadLetterOrders(ctx)
+}
+
+func (d *DeadLetter) Get(ctx context.Context, numOrder int64) (*models.DeadLetterOrder, error) {
+	const op = "DeadLetter.Get"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)))
+
+	log.Info("get dead-lettered order")
+
+	return d.store.GetDeadLetterOrder(ctx, numOrder)
+}
+
+func (d *DeadLetter) Requeue(ctx context.Context, numOrder int64) error {
+	const op = "DeadLetter.Requeue"
+
+	log := d.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)))
+
+	log.Info("requeue dead-lettered order")
+
+	if err := d.store.RequeueDeadLetterOrder(ctx, numOrder); err != nil {
+		log.Error("failed to requeue order", "error", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
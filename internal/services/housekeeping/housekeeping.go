@@ -0,0 +1,78 @@
+package housekeeping
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Job func(ctx context.Context, now time.Time) error
+
+type Housekeeping struct {
+	log      *slog.Logger
+	interval time.Duration
+	names    []string
+	jobs     []Job
+	wg       sync.WaitGroup
+	cancel   context.CancelFunc
+}
+
+func New(log *slog.Logger, interval time.Duration) *Housekeeping {
+	return &Housekeeping{
+		log:      log,
+		interval: interval,
+	}
+}
+
+func (h *Housekeeping) Register(name string, job Job) {
+	h.names = append(h.names, name)
+	h.jobs = append(h.jobs, job)
+}
+
+func (h *Housekeeping) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.cancel = cancel
+
+	h.wg.Add(1)
+	go h.loop(ctx)
+}
+
+func (h *Housekeeping) Stop() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	h.wg.Wait()
+}
+
+func (h *Housekeeping) loop(ctx context.Context) {
+	defer h.wg.Done()
+	const op = "Housekeeping.loop"
+
+	log := h.log.With(
+		slog.String("op", op))
+	log.Info("start housekeeping", slog.Int("jobs", len(h.jobs)))
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.RunOnce(ctx, now)
+		}
+	}
+}
+
+func (h *Housekeeping) RunOnce(ctx context.Context, now time.Time) {
+	for i, job := range h.jobs {
+		if err := job(ctx, now); err != nil {
+			h.log.Error("housekeeping job failed",
+				slog.String("job", h.names[i]),
+				"error", err,
+			)
+		}
+	}
+}
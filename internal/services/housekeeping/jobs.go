@@ -0,0 +1,86 @@
+package housekeeping
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreIdempotency interface {
+	PurgeIdempotencyKeys(ctx context.Context, before int64) (int64, error)
+}
+
+func PurgeIdempotencyKeys(log *slog.Logger, store StoreIdempotency, ttl time.Duration) Job {
+	return func(ctx context.Context, now time.Time) error {
+		const op = "Housekeeping.PurgeIdempotencyKeys"
+
+		purged, err := store.PurgeIdempotencyKeys(ctx, now.Add(-ttl).Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if purged > 0 {
+			log.Info("purged idempotency keys", slog.String("op", op), slog.Int64("count", purged))
+		}
+		return nil
+	}
+}
+
+type StoreCallbackSignatures interface {
+	PurgeCallbackSignatures(ctx context.Context, before int64) (int64, error)
+}
+
+func PurgeCallbackSignatures(log *slog.Logger, store StoreCallbackSignatures) Job {
+	return func(ctx context.Context, now time.Time) error {
+		const op = "Housekeeping.PurgeCallbackSignatures"
+
+		purged, err := store.PurgeCallbackSignatures(ctx, now.Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if purged > 0 {
+			log.Info("purged accrual callback signatures", slog.String("op", op), slog.Int64("count", purged))
+		}
+		return nil
+	}
+}
+
+type StoreReservations interface {
+	ExpireReservations(ctx context.Context, now int64) (int64, error)
+}
+
+func ExpireReservations(log *slog.Logger, store StoreReservations) Job {
+	return func(ctx context.Context, now time.Time) error {
+		const op = "Housekeeping.ExpireReservations"
+
+		expired, err := store.ExpireReservations(ctx, now.Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if expired > 0 {
+			log.Info("expired withdrawal reservations", slog.String("op", op), slog.Int64("count", expired))
+		}
+		return nil
+	}
+}
+
+type StorePoints interface {
+	ExpirePoints(ctx context.Context, now int64) (models.Money, error)
+}
+
+func ExpirePoints(log *slog.Logger, store StorePoints) Job {
+	return func(ctx context.Context, now time.Time) error {
+		const op = "Housekeeping.ExpirePoints"
+
+		expired, err := store.ExpirePoints(ctx, now.Unix())
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if expired > 0 {
+			log.Info("expired loyalty points", slog.String("op", op), slog.String("amount", expired.String()))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,82 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreLedger interface {
+	AddAdjustment(ctx context.Context, userID int64, amount models.Money, description string, created int64) error
+	GetStatement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error)
+	CheckBalances(ctx context.Context) (models.BalanceDriftArray, error)
+}
+
+type Ledger struct {
+	log   *slog.Logger
+	store StoreLedger
+}
+
+func New(log *slog.Logger, store StoreLedger) *Ledger {
+	return &Ledger{
+		log:   log,
+		store: store,
+	}
+}
+
+func (l *Ledger) Adjust(ctx context.Context, userID int64, amount models.Money, description string) error {
+	const op = "Ledger.Adjust"
+
+	log := l.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", userID)),
+		slog.String("amount", amount.String()))
+
+	if amount == 0 {
+		log.Error("adjustment rejected", "error", models.ErrInvalidAdjustment)
+		return fmt.Errorf("%s: %w", op, models.ErrInvalidAdjustment)
+	}
+
+	if err := l.store.AddAdjustment(ctx, userID, amount, description, time.Now().Unix()); err != nil {
+		log.Error("adjustment failed", "error", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("balance adjusted", slog.String("description", description))
+	return nil
+}
+
+func (l *Ledger) Statement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error) {
+	const op = "Ledger.Statement"
+
+	entries, err := l.store.GetStatement(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return entries, nil
+}
+
+func (l *Ledger) CheckBalances(ctx context.Context) (models.BalanceDriftArray, error) {
+	const op = "Ledger.CheckBalances"
+
+	log := l.log.With(
+		slog.String("op", op))
+
+	drifts, err := l.store.CheckBalances(ctx)
+	if err != nil {
+		log.Error("balance check failed", "error", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, drift := range drifts {
+		log.Warn("balance drift",
+			slog.Int64("user_id", drift.UserID),
+			slog.String("current", drift.Current.String()),
+			slog.String("expected_current", drift.ExpectedCurrent.String()),
+			slog.String("withdrawn", drift.Withdrawn.String()),
+			slog.String("expected_withdrawn", drift.ExpectedWithdrawn.String()),
+		)
+	}
+	return drifts, nil
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/ArtShib/gophermart.git/internal/config"
 	"github.com/ArtShib/gophermart.git/internal/lib/luhn"
 	"github.com/ArtShib/gophermart.git/internal/models"
 )
@@ -14,20 +15,26 @@ type StoreOrder interface {
 	AddOrder(ctx context.Context, numOrder int64, uploaded int64, userID int64) error
 	GetOrder(ctx context.Context, userID int64) (models.OrderArray, error)
 	GetBalance(ctx context.Context, userID int64) (*models.Balance, error)
+	GetExpiringPoints(ctx context.Context, userID int64, before int64) (models.ExpiringPointsArray, error)
 	GetWithdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error)
-	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64, processed int64) error
-	GetOrdersInWork(ctx context.Context) (models.OrderArray, error)
+	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, processed int64) error
+	GetStatement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error)
+	ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, created int64, expires int64) (*models.Reservation, error)
+	ConfirmReservation(ctx context.Context, numOrder int64, userID int64, now int64) error
+	CancelReservation(ctx context.Context, numOrder int64, userID int64, now int64) error
 }
 
 type Order struct {
-	log   *slog.Logger
-	store StoreOrder
+	log    *slog.Logger
+	store  StoreOrder
+	config config.PointsConfig
 }
 
-func New(log *slog.Logger, store StoreOrder) *Order {
+func New(log *slog.Logger, store StoreOrder, cfg config.PointsConfig) *Order {
 	return &Order{
-		log:   log,
-		store: store,
+		log:    log,
+		store:  store,
+		config: cfg,
 	}
 }
 
@@ -63,17 +70,6 @@ func (o *Order) Get(ctx context.Context, userID int64) (models.OrderArray, error
 	return o.store.GetOrder(ctx, userID)
 }
 
-func (o *Order) GetOrdersInWork(ctx context.Context) (models.OrderArray, error) {
-	const op = "Order.GetOrdersInWork"
-
-	log := o.log.With(
-		slog.String("op", op))
-
-	log.Info("get Orders In Work")
-
-	return o.store.GetOrdersInWork(ctx)
-}
-
 func (o *Order) Balance(ctx context.Context, userID int64) (*models.Balance, error) {
 	const op = "Order.GetBalance"
 
@@ -83,7 +79,18 @@ func (o *Order) Balance(ctx context.Context, userID int64) (*models.Balance, err
 
 	log.Info("get balance")
 
-	return o.store.GetBalance(ctx, userID)
+	balance, err := o.store.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if o.config.ExpiringWindow > 0 {
+		before := time.Now().Add(o.config.ExpiringWindow).Unix()
+		balance.Expiring, err = o.store.GetExpiringPoints(ctx, userID, before)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return balance, nil
 }
 
 func (o *Order) Withdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error) {
@@ -98,7 +105,7 @@ func (o *Order) Withdrawals(ctx context.Context, userID int64) (models.Withdrawa
 	return o.store.GetWithdrawals(ctx, userID)
 }
 
-func (o *Order) AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64) error {
+func (o *Order) AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) error {
 	const op = "Order.AddWithdrawal"
 
 	currentTime := time.Now().Unix()
@@ -114,6 +121,72 @@ func (o *Order) AddWithdraw(ctx context.Context, numOrder int64, userID int64, s
 		o.log.Error("order number is not valid", "error", models.ErrNotValidOrderNumber)
 		return models.ErrNotValidOrderNumber
 	}
+	if sum <= 0 {
+		o.log.Error("withdrawal sum is not positive", "error", models.ErrInvalidWithdrawSum)
+		return models.ErrInvalidWithdrawSum
+	}
 	err := o.store.AddWithdraw(ctx, numOrder, userID, sum, currentTime)
 	return err
 }
+
+func (o *Order) Statement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error) {
+	const op = "Order.GetStatement"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("get statement")
+
+	return o.store.GetStatement(ctx, userID, limit, offset)
+}
+
+func (o *Order) ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money) (*models.Reservation, error) {
+	const op = "Order.ReserveWithdraw"
+
+	currentTime := time.Now()
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("reserve withdrawal")
+
+	if !luhn.Valid(numOrder) {
+		o.log.Error("order number is not valid", "error", models.ErrNotValidOrderNumber)
+		return nil, models.ErrNotValidOrderNumber
+	}
+	if sum <= 0 {
+		o.log.Error("withdrawal sum is not positive", "error", models.ErrInvalidWithdrawSum)
+		return nil, models.ErrInvalidWithdrawSum
+	}
+	expires := currentTime.Add(o.config.ReservationTTL)
+	return o.store.ReserveWithdraw(ctx, numOrder, userID, sum, currentTime.Unix(), expires.Unix())
+}
+
+func (o *Order) ConfirmWithdraw(ctx context.Context, numOrder int64, userID int64) error {
+	const op = "Order.ConfirmWithdraw"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("confirm withdrawal")
+
+	return o.store.ConfirmReservation(ctx, numOrder, userID, time.Now().Unix())
+}
+
+func (o *Order) CancelWithdraw(ctx context.Context, numOrder int64, userID int64) error {
+	const op = "Order.CancelWithdraw"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("cancel withdrawal")
+
+	return o.store.CancelReservation(ctx, numOrder, userID, time.Now().Unix())
+}
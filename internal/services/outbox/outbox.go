@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreOutbox interface {
+	ClaimProcessedOrders(ctx context.Context, limit int, now int64, lease time.Duration) (models.ProcessedOrderArray, error)
+	AckProcessedOrder(ctx context.Context, numOrder int64) error
+	RetryProcessedOrder(ctx context.Context, numOrder int64, lastErr string, nextAttemptAt int64) error
+}
+
+// Handler reacts to an order that has reached PROCESSED. An event is retried
+// until every handler accepts it, so handlers must be idempotent.
+type Handler func(ctx context.Context, order models.ProcessedOrder) error
+
+// Outbox delivers the processed-order events UpdateOrdersBatch records in the
+// same transaction as the PROCESSED transition.
+type Outbox struct {
+	log      *slog.Logger
+	store    StoreOutbox
+	config   config.OutboxConfig
+	names    []string
+	handlers []Handler
+	notify   chan struct{}
+	wg       sync.WaitGroup
+	cancel   context.CancelFunc
+}
+
+func New(log *slog.Logger, store StoreOutbox, cfg config.OutboxConfig) *Outbox {
+	return &Outbox{
+		log:    log,
+		store:  store,
+		config: cfg,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (o *Outbox) Register(name string, handler Handler) {
+	o.names = append(o.names, name)
+	o.handlers = append(o.handlers, handler)
+}
+
+func (o *Outbox) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	o.cancel = cancel
+
+	o.wg.Add(1)
+	go o.loop(ctx)
+}
+
+func (o *Outbox) Stop() {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.wg.Wait()
+}
+
+// Notify wakes the dispatcher without waiting for the next tick.
+func (o *Outbox) Notify() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// OnProcessed lets the outbox subscribe to accrual batches as a wake-up call.
+func (o *Outbox) OnProcessed(ctx context.Context, orders models.ProcessedOrderArray) {
+	o.Notify()
+}
+
+func (o *Outbox) loop(ctx context.Context) {
+	defer o.wg.Done()
+	const op = "Outbox.loop"
+
+	log := o.log.With(
+		slog.String("op", op))
+	log.Info("start outbox", slog.Int("handlers", len(o.handlers)))
+
+	ticker := time.NewTicker(o.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.notify:
+		}
+		for {
+			delivered, err := o.RunOnce(ctx, time.Now())
+			if err != nil {
+				log.Error("failed to deliver processed orders", "error", err)
+				break
+			}
+			if delivered < o.config.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// RunOnce claims one batch of due events and hands each to every handler. It
+// returns how many events it claimed.
+func (o *Outbox) RunOnce(ctx context.Context, now time.Time) (int, error) {
+	const op = "Outbox.RunOnce"
+
+	orders, err := o.store.ClaimProcessedOrders(ctx, o.config.BatchSize, now.Unix(), o.config.LeaseTTL)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return len(orders), nil
+		}
+		o.deliver(ctx, order, now)
+	}
+	return len(orders), nil
+}
+
+func (o *Outbox) deliver(ctx context.Context, order models.ProcessedOrder, now time.Time) {
+	const op = "Outbox.deliver"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.Int64("number", order.OrderNum))
+
+	for i, handler := range o.handlers {
+		err := handler(ctx, order)
+		if err == nil {
+			continue
+		}
+		next := now.Add(o.retryDelay(order.Attempts))
+		log.Error("processed order handler failed",
+			slog.String("handler", o.names[i]),
+			slog.Int("attempts", order.Attempts+1),
+			slog.Time("next_attempt_at", next),
+			"error", err)
+		if err := o.store.RetryProcessedOrder(ctx, order.OrderNum, fmt.Sprintf("%s: %v", o.names[i], err), next.Unix()); err != nil {
+			log.Error("failed to reschedule processed order", "error", err)
+		}
+		return
+	}
+	if err := o.store.AckProcessedOrder(ctx, order.OrderNum); err != nil {
+		log.Error("failed to acknowledge processed order", "error", err)
+	}
+}
+
+func (o *Outbox) retryDelay(attempts int) time.Duration {
+	delay := o.config.RetryBaseDelay
+	for i := 0; i < attempts && delay < o.config.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > o.config.RetryMaxDelay {
+		delay = o.config.RetryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/storage/memory"
+)
+
+func processOrder(t *testing.T, store *memory.StoreMemory, numOrder int64) {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := store.AddOrder(ctx, numOrder, time.Now().Unix(), 1); err != nil {
+		t.Fatal(err)
+	}
+	_, err := store.UpdateOrdersBatch(ctx, models.ResAccrualOrderArray{
+		{OrderNum: numOrder, Status: models.StatusProcessed, Accrual: 10000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOnceRetriesUntilEveryHandlerSucceeds(t *testing.T) {
+	store := memory.NewMemoryStore(0)
+	processOrder(t, store, 12345678903)
+
+	o := New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, config.OutboxConfig{
+		BatchSize:      10,
+		LeaseTTL:       time.Minute,
+		RetryBaseDelay: 10 * time.Second,
+		RetryMaxDelay:  time.Minute,
+	})
+	calls := map[string]int{}
+	o.Register("tiers", func(ctx context.Context, order models.ProcessedOrder) error {
+		calls["tiers"]++
+		return nil
+	})
+	fail := true
+	o.Register("campaigns", func(ctx context.Context, order models.ProcessedOrder) error {
+		calls["campaigns"]++
+		if fail {
+			return errors.New("database is down")
+		}
+		if order.Attempts != 1 {
+			t.Errorf("attempts: got %d, want 1", order.Attempts)
+		}
+		return nil
+	})
+
+	ctx := context.Background()
+	now := time.Now()
+	if n, err := o.RunOnce(ctx, now); err != nil || n != 1 {
+		t.Fatalf("first run: got %d, %v", n, err)
+	}
+	if n, err := o.RunOnce(ctx, now.Add(9*time.Second)); err != nil || n != 0 {
+		t.Fatalf("run before retry delay: got %d, %v", n, err)
+	}
+
+	fail = false
+	if n, err := o.RunOnce(ctx, now.Add(10*time.Second)); err != nil || n != 1 {
+		t.Fatalf("retry run: got %d, %v", n, err)
+	}
+	if calls["tiers"] != 2 || calls["campaigns"] != 2 {
+		t.Fatalf("calls: got %v", calls)
+	}
+	if n, err := o.RunOnce(ctx, now.Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("event delivered twice: got %d, %v", n, err)
+	}
+}
+
+func TestRetryDelayDoublesUpToMax(t *testing.T) {
+	o := &Outbox{config: config.OutboxConfig{RetryBaseDelay: time.Second, RetryMaxDelay: 5 * time.Second}}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempts, delay := range want {
+		if got := o.retryDelay(attempts); got != delay {
+			t.Errorf("attempts %d: got %s, want %s", attempts, got, delay)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreReferral interface {
+	UserByID(ctx context.Context, userID int64) (*models.User, error)
+	AddReferralReward(ctx context.Context, reward models.ReferralReward) error
+	GetReferralStats(ctx context.Context, userID int64) (*models.ReferralStats, error)
+}
+
+type Referral struct {
+	log           *slog.Logger
+	store         StoreReferral
+	referrerBonus models.Money
+	refereeBonus  models.Money
+}
+
+func New(log *slog.Logger, store StoreReferral, cfg config.ReferralConfig) (*Referral, error) {
+	const op = "Referral.New"
+
+	r := &Referral{
+		log:   log,
+		store: store,
+	}
+	for _, bonus := range []struct {
+		value string
+		dst   *models.Money
+	}{
+		{cfg.ReferrerBonus, &r.referrerBonus},
+		{cfg.RefereeBonus, &r.refereeBonus},
+	} {
+		if bonus.value == "" {
+			continue
+		}
+		amount, err := models.ParseMoney(bonus.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if amount < 0 {
+			return nil, fmt.Errorf("%s: referral bonus must not be negative", op)
+		}
+		*bonus.dst = amount
+	}
+	return r, nil
+}
+
+// OnProcessed rewards both sides of a referral once the referred user's
+// first order reaches PROCESSED. It is an outbox handler: a referral already
+// rewarded counts as done.
+func (r *Referral) OnProcessed(ctx context.Context, order models.ProcessedOrder) error {
+	if r.referrerBonus == 0 && r.refereeBonus == 0 {
+		return nil
+	}
+	if order.Position != 1 {
+		return nil
+	}
+	if err := r.Reward(ctx, order, time.Now().Unix()); err != nil && !errors.Is(err, models.ErrReferralRewarded) {
+		return err
+	}
+	return nil
+}
+
+func (r *Referral) Reward(ctx context.Context, order models.ProcessedOrder, now int64) error {
+	const op = "Referral.Reward"
+
+	user, err := r.store.UserByID(ctx, order.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.ReferredBy == 0 {
+		return nil
+	}
+
+	err = r.store.AddReferralReward(ctx, models.ReferralReward{
+		ReferredUserID: user.ID,
+		ReferrerID:     user.ReferredBy,
+		OrderNum:       order.OrderNum,
+		ReferrerBonus:  r.referrerBonus,
+		RefereeBonus:   r.refereeBonus,
+		CreatedAt:      now,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.log.Info("referral rewarded",
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+		slog.Int64("referrer_id", user.ReferredBy),
+		slog.Int64("number", order.OrderNum))
+	return nil
+}
+
+func (r *Referral) Stats(ctx context.Context, userID int64) (*models.ReferralStats, error) {
+	const op = "Referral.Stats"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("get referral stats")
+
+	stats, err := r.store.GetReferralStats(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,84 @@
+package referral
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type stubStore struct {
+	rewards []models.ReferralReward
+	err     error
+}
+
+func (s *stubStore) UserByID(ctx context.Context, userID int64) (*models.User, error) {
+	return &models.User{ID: userID, ReferredBy: 1}, nil
+}
+
+func (s *stubStore) AddReferralReward(ctx context.Context, reward models.ReferralReward) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.rewards = append(s.rewards, reward)
+	return nil
+}
+
+func (s *stubStore) GetReferralStats(ctx context.Context, userID int64) (*models.ReferralStats, error) {
+	return &models.ReferralStats{}, nil
+}
+
+func newReferral(t *testing.T, store StoreReferral, cfg config.ReferralConfig) *Referral {
+	t.Helper()
+
+	r, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), store, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestOnProcessedPaysNothingWithoutConfiguredBonuses(t *testing.T) {
+	store := &stubStore{}
+	r := newReferral(t, store, config.ReferralConfig{})
+	if err := r.OnProcessed(context.Background(), models.ProcessedOrder{OrderNum: 12345678903, UserID: 2, Position: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.rewards) != 0 {
+		t.Fatalf("rewards: got %+v", store.rewards)
+	}
+}
+
+func TestOnProcessedRewardsOnlyTheFirstOrder(t *testing.T) {
+	store := &stubStore{}
+	r := newReferral(t, store, config.ReferralConfig{ReferrerBonus: "100", RefereeBonus: "50"})
+	ctx := context.Background()
+	if err := r.OnProcessed(ctx, models.ProcessedOrder{OrderNum: 79927398713, UserID: 2, Position: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.OnProcessed(ctx, models.ProcessedOrder{OrderNum: 12345678903, UserID: 2, Position: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.rewards) != 1 || store.rewards[0].OrderNum != 12345678903 ||
+		store.rewards[0].ReferrerBonus != 10000 || store.rewards[0].RefereeBonus != 5000 {
+		t.Fatalf("rewards: got %+v", store.rewards)
+	}
+}
+
+func TestOnProcessedReportsFailuresForRetry(t *testing.T) {
+	order := models.ProcessedOrder{OrderNum: 12345678903, UserID: 2, Position: 1}
+
+	store := &stubStore{err: models.ErrReferralRewarded}
+	r := newReferral(t, store, config.ReferralConfig{ReferrerBonus: "100"})
+	if err := r.OnProcessed(context.Background(), order); err != nil {
+		t.Fatalf("already rewarded: got %v", err)
+	}
+
+	store.err = context.DeadlineExceeded
+	if err := r.OnProcessed(context.Background(), order); err == nil {
+		t.Fatal("want error so the outbox retries")
+	}
+}
@@ -0,0 +1,55 @@
+package refund
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreRefund interface {
+	ReverseWithdrawal(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string, processed int64) (*models.Withdrawals, error)
+}
+
+type Refund struct {
+	log   *slog.Logger
+	store StoreRefund
+}
+
+func New(log *slog.Logger, store StoreRefund) *Refund {
+	return &Refund{
+		log:   log,
+		store: store,
+	}
+}
+
+func (r *Refund) Reverse(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string) (*models.Withdrawals, error) {
+	const op = "Refund.Reverse"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.String("number", fmt.Sprintf("%v", numOrder)),
+		slog.String("sum", sum.String()),
+		slog.String("operator", operator))
+
+	log.Info("reverse withdrawal")
+
+	if sum < 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrInvalidReversal)
+	}
+	operator, reason = strings.TrimSpace(operator), strings.TrimSpace(reason)
+	if operator == "" || reason == "" {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrReversalUnattributed)
+	}
+
+	reversal, err := r.store.ReverseWithdrawal(ctx, numOrder, sum, operator, reason, time.Now().Unix())
+	if err != nil {
+		log.Error("failed to reverse withdrawal", "error", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("withdrawal reversed", slog.String("reversed", (-reversal.Sum).String()))
+	return reversal, nil
+}
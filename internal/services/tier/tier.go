@@ -0,0 +1,152 @@
+package tier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreTier interface {
+	GetLifetimeAccrual(ctx context.Context, userID int64) (models.Money, error)
+	SetUserTier(ctx context.Context, userID int64, tier string, changedAt int64) (string, error)
+}
+
+// Listener is told whenever a user moves to a different tier.
+type Listener func(ctx context.Context, change models.TierChange)
+
+type Tier struct {
+	log       *slog.Logger
+	store     StoreTier
+	tiers     models.TierArray
+	listeners []Listener
+	mu        sync.RWMutex
+}
+
+func New(log *slog.Logger, store StoreTier, cfg config.TiersConfig) (*Tier, error) {
+	const op = "Tier.New"
+
+	tiers := make(models.TierArray, 0, len(cfg.Tiers))
+	names := make(map[string]struct{}, len(cfg.Tiers))
+	for _, tc := range cfg.Tiers {
+		if tc.Name == "" {
+			return nil, fmt.Errorf("%s: tier name is required", op)
+		}
+		if _, ok := names[tc.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate tier %q", op, tc.Name)
+		}
+		names[tc.Name] = struct{}{}
+
+		threshold, err := models.ParseMoney(tc.Threshold.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: tier %q: %w", op, tc.Name, err)
+		}
+		perks := tc.Perks
+		if perks == nil {
+			perks = []string{}
+		}
+		tiers = append(tiers, models.Tier{Name: tc.Name, Threshold: threshold, Perks: perks})
+	}
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Threshold < tiers[j].Threshold
+	})
+	if len(tiers) == 0 || tiers[0].Threshold != 0 {
+		return nil, fmt.Errorf("%s: the lowest tier must start at zero", op)
+	}
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].Threshold == tiers[i-1].Threshold {
+			return nil, fmt.Errorf("%s: tiers %q and %q share a threshold", op, tiers[i-1].Name, tiers[i].Name)
+		}
+	}
+
+	return &Tier{
+		log:   log,
+		store: store,
+		tiers: tiers,
+	}, nil
+}
+
+func (t *Tier) Subscribe(listener Listener) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, listener)
+}
+
+func (t *Tier) Profile(ctx context.Context, userID int64) (*models.Profile, error) {
+	const op = "Tier.Profile"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("get profile")
+
+	lifetime, err := t.store.GetLifetimeAccrual(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	current, next := t.tiers.TierFor(lifetime)
+	profile := &models.Profile{
+		Tier:            current.Name,
+		Perks:           current.Perks,
+		LifetimeAccrual: lifetime,
+	}
+	if next != nil {
+		profile.NextTier = next.Name
+		profile.ToNextTier = next.Threshold - lifetime
+	}
+	return profile, nil
+}
+
+// TierAt names the tier a lifetime accrual falls in.
+func (t *Tier) TierAt(lifetime models.Money) string {
+	current, _ := t.tiers.TierFor(lifetime)
+	return current.Name
+}
+
+// OnProcessed re-evaluates the tier of the user who owns order.
+func (t *Tier) OnProcessed(ctx context.Context, order models.ProcessedOrder) error {
+	return t.Refresh(ctx, order.UserID)
+}
+
+func (t *Tier) Refresh(ctx context.Context, userID int64) error {
+	const op = "Tier.Refresh"
+
+	lifetime, err := t.store.GetLifetimeAccrual(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	current, _ := t.tiers.TierFor(lifetime)
+
+	now := time.Now().Unix()
+	previous, err := t.store.SetUserTier(ctx, userID, current.Name, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if previous == "" {
+		previous = t.tiers[0].Name
+	}
+	if previous == current.Name {
+		return nil
+	}
+
+	change := models.TierChange{
+		UserID:          userID,
+		From:            previous,
+		To:              current.Name,
+		LifetimeAccrual: lifetime,
+		ChangedAt:       now,
+	}
+	t.mu.RLock()
+	listeners := t.listeners
+	t.mu.RUnlock()
+	for _, listener := range listeners {
+		listener(ctx, change)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type StoreTransfer interface {
+	User(ctx context.Context, login string) (*models.User, error)
+	AddTransfer(ctx context.Context, fromUserID int64, toUserID int64, sum models.Money, limit models.TransferLimit, since int64, created int64) (*models.Transfer, error)
+	GetTransfers(ctx context.Context, userID int64) (models.TransferArray, error)
+}
+
+type Transfer struct {
+	log   *slog.Logger
+	store StoreTransfer
+	limit models.TransferLimit
+}
+
+func New(log *slog.Logger, store StoreTransfer, cfg config.TransferConfig) (*Transfer, error) {
+	const op = "Transfer.New"
+
+	limit := models.TransferLimit{DailyCount: cfg.DailyCount}
+	if cfg.DailyLimit != "" {
+		sum, err := models.ParseMoney(cfg.DailyLimit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		limit.DailySum = sum
+	}
+
+	return &Transfer{
+		log:   log,
+		store: store,
+		limit: limit,
+	}, nil
+}
+
+func (t *Transfer) Send(ctx context.Context, fromUserID int64, toLogin string, sum models.Money) (*models.UserTransfer, error) {
+	const op = "Transfer.Send"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", fromUserID)),
+		slog.String("to", toLogin),
+		slog.String("sum", sum.String()))
+
+	log.Info("transfer points")
+
+	if sum <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrInvalidTransfer)
+	}
+	recipient, err := t.store.User(ctx, strings.TrimSpace(toLogin))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if recipient.ID == fromUserID {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTransferToSelf)
+	}
+
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Unix()
+	transfer, err := t.store.AddTransfer(ctx, fromUserID, recipient.ID, sum, t.limit, dayStart, now.Unix())
+	if err != nil {
+		log.Error("failed to transfer points", "error", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	view := transfer.ForUser(fromUserID)
+	return &view, nil
+}
+
+func (t *Transfer) History(ctx context.Context, userID int64) (models.UserTransferArray, error) {
+	const op = "Transfer.History"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("user_id", fmt.Sprintf("%v", userID)))
+
+	log.Info("get transfers")
+
+	transfers, err := t.store.GetTransfers(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	history := make(models.UserTransferArray, 0, len(transfers))
+	for _, transfer := range transfers {
+		history = append(history, transfer.ForUser(userID))
+	}
+	return history, nil
+}
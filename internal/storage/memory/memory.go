@@ -0,0 +1,1292 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+)
+
+type orderRow struct {
+	id                 int64
+	number             int64
+	status             string
+	accrual            models.Money
+	bonuses            models.OrderBonusArray
+	uploadedAt         int64
+	userID             int64
+	notRegisteredCount int
+	notRegisteredAt    int64
+	lockedUntil        int64
+	lockedBy           string
+	nextPollAt         int64
+	attempts           int
+	failures           int
+	lastError          string
+	deadLetteredAt     int64
+	processedAt        int64
+}
+
+type processedEvent struct {
+	order         models.ProcessedOrder
+	nextAttemptAt int64
+	lastError     string
+}
+
+type withdrawalRow struct {
+	id          int64
+	number      int64
+	userID      int64
+	sum         models.Money
+	processedAt int64
+	reversalOf  int64
+	reversedBy  string
+	reason      string
+	ledgerTxID  int64
+}
+
+type lotSpend struct {
+	txID     int64
+	lot      *models.PointLot
+	amount   models.Money
+	restored models.Money
+}
+
+type StoreMemory struct {
+	mu                 sync.Mutex
+	users              map[string]*models.User
+	nextUserID         int64
+	orders             []*orderRow
+	ordersByNumber     map[int64]*orderRow
+	nextOrderID        int64
+	withdrawals        []*withdrawalRow
+	withdrawalsByNum   map[int64]*withdrawalRow
+	nextWithdrawalID   int64
+	ledger             []models.LedgerEntry
+	nextLedgerTxID     int64
+	balances           map[int64]*models.Balance
+	idempotencyKeys    map[idempotencyKey]*models.IdempotencyRecord
+	reservations       map[int64]*models.Reservation
+	nextReservationID  int64
+	lots               []*models.PointLot
+	spends             []*lotSpend
+	pointsLifetime     int
+	tiers              map[int64]string
+	transfers          []models.Transfer
+	referralRewards    map[int64]models.ReferralReward
+	processedEvents    []*processedEvent
+	callbackSignatures map[string]int64
+}
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+func NewMemoryStore(pointsLifetimeMonths int) *StoreMemory {
+	return &StoreMemory{
+		users:              make(map[string]*models.User),
+		ordersByNumber:     make(map[int64]*orderRow),
+		withdrawalsByNum:   make(map[int64]*withdrawalRow),
+		balances:           make(map[int64]*models.Balance),
+		idempotencyKeys:    make(map[idempotencyKey]*models.IdempotencyRecord),
+		reservations:       make(map[int64]*models.Reservation),
+		pointsLifetime:     pointsLifetimeMonths,
+		tiers:              make(map[int64]string),
+		referralRewards:    make(map[int64]models.ReferralReward),
+		callbackSignatures: make(map[string]int64),
+	}
+}
+
+func (m *StoreMemory) Close() error {
+	return nil
+}
+
+func (m *StoreMemory) SaveUser(ctx context.Context, login string, passHash []byte, referralCode string, referredBy int64) (*models.User, error) {
+	const op = "storage.memory.SaveUser"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[login]; ok {
+		return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserExists)
+	}
+	for _, user := range m.users {
+		if user.ReferralCode == referralCode {
+			return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrReferralCodeTaken)
+		}
+	}
+	if referredBy != 0 && (referredBy > m.nextUserID || referredBy <= 0) {
+		return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrInvalidReferralCode)
+	}
+	m.nextUserID++
+	user := &models.User{
+		ID:           m.nextUserID,
+		Login:        login,
+		PassHash:     passHash,
+		CreatedAt:    time.Now().Unix(),
+		ReferralCode: referralCode,
+		ReferredBy:   referredBy,
+	}
+	m.users[login] = user
+
+	saved := *user
+	return &saved, nil
+}
+
+func (m *StoreMemory) User(ctx context.Context, login string) (*models.User, error) {
+	const op = "storage.memory.User"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[login]
+	if !ok {
+		return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+	}
+	found := *user
+	return &found, nil
+}
+
+func (m *StoreMemory) UserByID(ctx context.Context, userID int64) (*models.User, error) {
+	const op = "storage.memory.UserByID"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.ID == userID {
+			found := *user
+			return &found, nil
+		}
+	}
+	return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+}
+
+func (m *StoreMemory) UserByReferralCode(ctx context.Context, code string) (*models.User, error) {
+	const op = "storage.memory.UserByReferralCode"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.ReferralCode == code {
+			found := *user
+			return &found, nil
+		}
+	}
+	return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrInvalidReferralCode)
+}
+
+func (m *StoreMemory) AddReferralReward(ctx context.Context, reward models.ReferralReward) error {
+	const op = "storage.memory.AddReferralReward"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.referralRewards[reward.ReferredUserID]; ok {
+		return fmt.Errorf("%s: %w", op, models.ErrReferralRewarded)
+	}
+	m.referralRewards[reward.ReferredUserID] = reward
+
+	postings := make([]posting, 0, 3)
+	if reward.RefereeBonus > 0 {
+		postings = append(postings, posting{account: models.LedgerAccountUser, userID: reward.ReferredUserID, amount: reward.RefereeBonus})
+	}
+	if reward.ReferrerBonus > 0 {
+		postings = append(postings, posting{account: models.LedgerAccountUser, userID: reward.ReferrerID, amount: reward.ReferrerBonus})
+	}
+	postings = append(postings, posting{account: models.LedgerAccountReferral, amount: -(reward.RefereeBonus + reward.ReferrerBonus)})
+	m.postLedger(models.LedgerKindReferral, reward.OrderNum, "referral bonus", reward.CreatedAt, postings...)
+	return nil
+}
+
+func (m *StoreMemory) GetReferralStats(ctx context.Context, userID int64) (*models.ReferralStats, error) {
+	const op = "storage.memory.GetReferralStats"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := &models.ReferralStats{}
+	found := false
+	for _, user := range m.users {
+		if user.ID == userID {
+			stats.Code = user.ReferralCode
+			found = true
+		}
+		if user.ReferredBy == userID {
+			stats.Referred++
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+	}
+	for _, reward := range m.referralRewards {
+		if reward.ReferrerID == userID {
+			stats.Rewarded++
+			stats.Earned += reward.ReferrerBonus
+		}
+	}
+	return stats, nil
+}
+
+func (m *StoreMemory) AddOrder(ctx context.Context, numOrder int64, uploaded int64, userID int64) error {
+	const op = "storage.memory.AddOrder"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.ordersByNumber[numOrder]; ok {
+		if existing.userID == userID {
+			return fmt.Errorf("%s: %w", op, models.ErrOrderExists)
+		}
+		return fmt.Errorf("%s: %w", op, models.ErrOrderExistsOtherUser)
+	}
+	m.insertOrder(numOrder, uploaded, userID)
+	return nil
+}
+
+func (m *StoreMemory) insertOrder(numOrder int64, uploaded int64, userID int64) *orderRow {
+	m.nextOrderID++
+	row := &orderRow{
+		id:         m.nextOrderID,
+		number:     numOrder,
+		status:     models.StatusNew,
+		uploadedAt: uploaded,
+		userID:     userID,
+	}
+	m.orders = append(m.orders, row)
+	m.ordersByNumber[numOrder] = row
+	return row
+}
+
+func (m *StoreMemory) GetOrder(ctx context.Context, userID int64) (models.OrderArray, error) {
+	const op = "storage.memory.GetOrder"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orderArray := models.OrderArray{}
+	for _, row := range m.orders {
+		if row.userID == userID {
+			orderArray = append(orderArray, row.toOrder())
+		}
+	}
+	sort.SliceStable(orderArray, func(i, j int) bool {
+		return orderArray[i].UploadedAt > orderArray[j].UploadedAt
+	})
+
+	if len(orderArray) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrOrderEmpty)
+	}
+	return orderArray, nil
+}
+
+func (m *StoreMemory) GetBalance(ctx context.Context, userID int64) (*models.Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balance := m.balance(userID)
+	balance.Current -= balance.Reserved
+	return balance, nil
+}
+
+func (m *StoreMemory) available(userID int64) models.Money {
+	balance := m.balance(userID)
+	return balance.Current - balance.Reserved
+}
+
+func (m *StoreMemory) balance(userID int64) *models.Balance {
+	balance := &models.Balance{}
+	if stored, ok := m.balances[userID]; ok {
+		*balance = *stored
+	}
+	return balance
+}
+
+func (m *StoreMemory) ledgerBalance(userID int64) *models.Balance {
+	balance := &models.Balance{}
+	for _, entry := range m.ledger {
+		if entry.Account != models.LedgerAccountUser || entry.UserID != userID {
+			continue
+		}
+		balance.Current += entry.Amount
+		if entry.Kind == models.LedgerKindWithdrawal || entry.Kind == models.LedgerKindReversal {
+			balance.Withdrawn -= entry.Amount
+		}
+	}
+	return balance
+}
+
+func (m *StoreMemory) GetWithdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error) {
+	const op = "storage.memory.GetWithdrawals"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	withdrawalsArray := models.WithdrawalsArray{}
+	for _, row := range m.withdrawals {
+		if row.userID != userID {
+			continue
+		}
+		withdrawalsArray = append(withdrawalsArray, row.toWithdrawals())
+	}
+
+	if len(withdrawalsArray) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalsEmpty)
+	}
+	return withdrawalsArray, nil
+}
+
+func (m *StoreMemory) AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, processed int64) error {
+	const op = "storage.memory.AddWithdrawal"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sum <= 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrInvalidWithdrawSum)
+	}
+	if m.available(userID) <= sum {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
+	if _, ok := m.withdrawalsByNum[numOrder]; ok {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+	if r, ok := m.reservations[numOrder]; ok && r.Status == models.ReservationReserved {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+	m.insertWithdrawal(numOrder, userID, sum, processed)
+	return nil
+}
+
+func (m *StoreMemory) insertWithdrawal(numOrder int64, userID int64, sum models.Money, processed int64) {
+	m.nextWithdrawalID++
+	row := &withdrawalRow{
+		id:          m.nextWithdrawalID,
+		number:      numOrder,
+		userID:      userID,
+		sum:         sum,
+		processedAt: processed,
+	}
+	m.withdrawals = append(m.withdrawals, row)
+	m.withdrawalsByNum[numOrder] = row
+	m.postLedger(models.LedgerKindWithdrawal, numOrder, "", processed,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: -sum},
+		posting{account: models.LedgerAccountWithdrawal, amount: sum},
+	)
+	row.ledgerTxID = m.nextLedgerTxID
+}
+
+func (m *StoreMemory) ReverseWithdrawal(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string, processed int64) (*models.Withdrawals, error) {
+	const op = "storage.memory.ReverseWithdrawal"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	original, ok := m.withdrawalsByNum[numOrder]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalNotFound)
+	}
+	var reversed models.Money
+	for _, row := range m.withdrawals {
+		if row.reversalOf == original.id {
+			reversed -= row.sum
+		}
+	}
+	sum, err := models.ReversalSum(original.sum, reversed, sum)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.nextWithdrawalID++
+	row := &withdrawalRow{
+		id:          m.nextWithdrawalID,
+		number:      numOrder,
+		userID:      original.userID,
+		sum:         -sum,
+		processedAt: processed,
+		reversalOf:  original.id,
+		reversedBy:  operator,
+		reason:      reason,
+	}
+	m.withdrawals = append(m.withdrawals, row)
+	m.postLedger(models.LedgerKindReversal, numOrder, reason, processed,
+		posting{account: models.LedgerAccountUser, userID: original.userID, amount: sum, restoreTx: original.ledgerTxID},
+		posting{account: models.LedgerAccountWithdrawal, amount: -sum},
+	)
+
+	reversal := row.toWithdrawals()
+	return &reversal, nil
+}
+
+func (m *StoreMemory) ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, created int64, expires int64) (*models.Reservation, error) {
+	const op = "storage.memory.ReserveWithdraw"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sum <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrInvalidWithdrawSum)
+	}
+	if m.available(userID) <= sum {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
+	if _, ok := m.withdrawalsByNum[numOrder]; ok {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+	if _, ok := m.reservations[numOrder]; ok {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+
+	m.nextReservationID++
+	reservation := &models.Reservation{
+		ID:        m.nextReservationID,
+		UserID:    userID,
+		OrderNum:  numOrder,
+		Sum:       sum,
+		Status:    models.ReservationReserved,
+		CreatedAt: created,
+		ExpiresAt: expires,
+	}
+	m.reservations[numOrder] = reservation
+	m.userBalance(userID).Reserved += sum
+
+	reserved := *reservation
+	return &reserved, nil
+}
+
+func (m *StoreMemory) ConfirmReservation(ctx context.Context, numOrder int64, userID int64, now int64) error {
+	const op = "storage.memory.ConfirmReservation"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.resolveReservation(numOrder, userID, now, models.ReservationConfirmed); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (m *StoreMemory) CancelReservation(ctx context.Context, numOrder int64, userID int64, now int64) error {
+	const op = "storage.memory.CancelReservation"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.resolveReservation(numOrder, userID, now, models.ReservationCancelled); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (m *StoreMemory) resolveReservation(numOrder int64, userID int64, now int64, status string) error {
+	reservation, ok := m.reservations[numOrder]
+	if !ok || reservation.UserID != userID {
+		return models.ErrReservationNotFound
+	}
+	if err := models.CanResolveReservation(reservation.Status, status, reservation.ExpiresAt, now); err != nil {
+		return err
+	}
+	reservation.Status = status
+	reservation.ResolvedAt = now
+	m.userBalance(userID).Reserved -= reservation.Sum
+	if status == models.ReservationConfirmed {
+		m.insertWithdrawal(numOrder, userID, reservation.Sum, now)
+	}
+	return nil
+}
+
+func (m *StoreMemory) ExpireReservations(ctx context.Context, now int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired int64
+	for _, reservation := range m.reservations {
+		if reservation.Status != models.ReservationReserved || reservation.ExpiresAt > now {
+			continue
+		}
+		reservation.Status = models.ReservationExpired
+		reservation.ResolvedAt = now
+		m.userBalance(reservation.UserID).Reserved -= reservation.Sum
+		expired++
+	}
+	return expired, nil
+}
+
+func (m *StoreMemory) userBalance(userID int64) *models.Balance {
+	balance, ok := m.balances[userID]
+	if !ok {
+		balance = &models.Balance{}
+		m.balances[userID] = balance
+	}
+	return balance
+}
+
+func (m *StoreMemory) AddAdjustment(ctx context.Context, userID int64, amount models.Money, description string, created int64) error {
+	const op = "storage.memory.AddAdjustment"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.userExists(userID) {
+		return fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+	}
+	if amount < 0 && m.available(userID)+amount < 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
+	m.postLedger(models.LedgerKindAdjustment, 0, description, created,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: amount},
+		posting{account: models.LedgerAccountAdjustment, amount: -amount},
+	)
+	return nil
+}
+
+func (m *StoreMemory) GetStatement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error) {
+	const op = "storage.memory.GetStatement"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := models.LedgerEntryArray{}
+	for i := len(m.ledger) - 1; i >= 0; i-- {
+		entry := m.ledger[i]
+		if entry.Account == models.LedgerAccountUser && entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	if offset >= len(entries) {
+		entries = entries[:0]
+	} else {
+		entries = entries[offset:]
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrStatementEmpty)
+	}
+	return entries, nil
+}
+
+// posting is one leg of a ledger transaction. A user credit normally earns a
+// fresh lot; with carry it takes over the lots spent by the debits posted
+// before it in the same transaction, and with restoreTx it puts back the lots
+// that transaction spent.
+type posting struct {
+	account   string
+	userID    int64
+	amount    models.Money
+	carry     bool
+	restoreTx int64
+}
+
+func (m *StoreMemory) postLedger(kind string, numOrder int64, description string, created int64, postings ...posting) {
+	m.nextLedgerTxID++
+	txID := m.nextLedgerTxID
+	for _, p := range postings {
+		m.ledger = append(m.ledger, models.LedgerEntry{
+			ID:          int64(len(m.ledger)) + 1,
+			TxID:        txID,
+			UserID:      p.userID,
+			Account:     p.account,
+			Kind:        kind,
+			Amount:      p.amount,
+			OrderNum:    numOrder,
+			Description: description,
+			CreatedAt:   created,
+		})
+		if p.account != models.LedgerAccountUser {
+			continue
+		}
+
+		balance := m.userBalance(p.userID)
+		balance.Current += p.amount
+		if kind == models.LedgerKindWithdrawal || kind == models.LedgerKindReversal {
+			balance.Withdrawn -= p.amount
+		}
+
+		if p.amount > 0 {
+			m.creditLots(txID, kind, numOrder, created, p)
+		} else {
+			m.consumeLots(txID, p.userID, -p.amount)
+		}
+	}
+}
+
+func (m *StoreMemory) creditLots(txID int64, kind string, numOrder int64, created int64, p posting) {
+	left := p.amount
+	switch {
+	case p.carry:
+		for _, spend := range m.spends {
+			if spend.txID != txID || left <= 0 {
+				continue
+			}
+			amount := min(spend.amount, left)
+			m.addLot(p.userID, kind, numOrder, amount, spend.lot.EarnedAt, spend.lot.ExpiresAt)
+			left -= amount
+		}
+	case p.restoreTx != 0:
+		spends := make([]*lotSpend, 0)
+		for _, spend := range m.spends {
+			if spend.txID == p.restoreTx && spend.amount > spend.restored {
+				spends = append(spends, spend)
+			}
+		}
+		sort.SliceStable(spends, func(i, j int) bool {
+			return !expiresBefore(spends[i].lot, spends[j].lot)
+		})
+		for _, spend := range spends {
+			if left <= 0 {
+				break
+			}
+			amount := min(spend.amount-spend.restored, left)
+			spend.lot.Remaining += amount
+			spend.restored += amount
+			left -= amount
+		}
+	}
+	if left > 0 {
+		m.addLot(p.userID, kind, numOrder, left, created, models.PointsExpireAt(created, m.pointsLifetime))
+	}
+}
+
+func (m *StoreMemory) addLot(userID int64, kind string, numOrder int64, amount models.Money, earned int64, expires int64) {
+	m.lots = append(m.lots, &models.PointLot{
+		ID:        int64(len(m.lots)) + 1,
+		UserID:    userID,
+		Source:    kind,
+		OrderNum:  numOrder,
+		Amount:    amount,
+		Remaining: amount,
+		EarnedAt:  earned,
+		ExpiresAt: expires,
+	})
+}
+
+// expiresBefore orders lots by expiry with never-expiring lots last, then by id.
+func expiresBefore(a, b *models.PointLot) bool {
+	if (a.ExpiresAt == 0) != (b.ExpiresAt == 0) {
+		return b.ExpiresAt == 0
+	}
+	if a.ExpiresAt != b.ExpiresAt {
+		return a.ExpiresAt < b.ExpiresAt
+	}
+	return a.ID < b.ID
+}
+
+func (m *StoreMemory) consumeLots(txID int64, userID int64, amount models.Money) {
+	lots := make([]*models.PointLot, 0)
+	for _, lot := range m.lots {
+		if lot.UserID == userID && lot.Remaining > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	sort.SliceStable(lots, func(i, j int) bool {
+		return expiresBefore(lots[i], lots[j])
+	})
+	for _, lot := range lots {
+		if amount <= 0 {
+			return
+		}
+		take := min(lot.Remaining, amount)
+		lot.Remaining -= take
+		amount -= take
+		m.spends = append(m.spends, &lotSpend{txID: txID, lot: lot, amount: take})
+	}
+}
+
+func (m *StoreMemory) GetExpiringPoints(ctx context.Context, userID int64, before int64) (models.ExpiringPointsArray, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byDay := make(map[int64]models.Money)
+	for _, lot := range m.lots {
+		if lot.UserID != userID || lot.Remaining <= 0 || lot.ExpiresAt == 0 || lot.ExpiresAt > before {
+			continue
+		}
+		byDay[models.ExpiryDay(lot.ExpiresAt)] += lot.Remaining
+	}
+
+	expiring := models.ExpiringPointsArray{}
+	for day, amount := range byDay {
+		expiring = append(expiring, models.ExpiringPoints{Date: day, Amount: amount})
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].Date < expiring[j].Date
+	})
+	return expiring, nil
+}
+
+func (m *StoreMemory) ExpirePoints(ctx context.Context, now int64) (models.Money, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiredByUser := make(map[int64]models.Money)
+	for _, lot := range m.lots {
+		if lot.Remaining > 0 && lot.ExpiresAt != 0 && lot.ExpiresAt <= now {
+			expiredByUser[lot.UserID] += lot.Remaining
+		}
+	}
+
+	userIDs := make([]int64, 0, len(expiredByUser))
+	for userID := range expiredByUser {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	var total models.Money
+	for _, userID := range userIDs {
+		amount := min(expiredByUser[userID], m.available(userID))
+		if amount <= 0 {
+			continue
+		}
+		m.postLedger(models.LedgerKindExpiration, 0, "", now,
+			posting{account: models.LedgerAccountUser, userID: userID, amount: -amount},
+			posting{account: models.LedgerAccountExpiration, amount: amount},
+		)
+		total += amount
+	}
+	return total, nil
+}
+
+func (m *StoreMemory) CheckBalances(ctx context.Context) (models.BalanceDriftArray, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userIDs := make(map[int64]struct{}, len(m.balances))
+	for userID := range m.balances {
+		userIDs[userID] = struct{}{}
+	}
+	for _, entry := range m.ledger {
+		if entry.Account == models.LedgerAccountUser {
+			userIDs[entry.UserID] = struct{}{}
+		}
+	}
+
+	for _, reservation := range m.reservations {
+		userIDs[reservation.UserID] = struct{}{}
+	}
+
+	drifts := models.BalanceDriftArray{}
+	for userID := range userIDs {
+		stored := m.balance(userID)
+		expected := m.ledgerBalance(userID)
+		for _, reservation := range m.reservations {
+			if reservation.UserID == userID && reservation.Status == models.ReservationReserved {
+				expected.Reserved += reservation.Sum
+			}
+		}
+		if stored.Current != expected.Current || stored.Withdrawn != expected.Withdrawn || stored.Reserved != expected.Reserved {
+			drifts = append(drifts, models.BalanceDrift{
+				UserID:            userID,
+				Current:           stored.Current,
+				ExpectedCurrent:   expected.Current,
+				Withdrawn:         stored.Withdrawn,
+				ExpectedWithdrawn: expected.Withdrawn,
+				Reserved:          stored.Reserved,
+				ExpectedReserved:  expected.Reserved,
+			})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].UserID < drifts[j].UserID
+	})
+	return drifts, nil
+}
+
+func (m *StoreMemory) userExists(userID int64) bool {
+	for _, user := range m.users {
+		if user.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *StoreMemory) ClaimOrdersInWork(ctx context.Context, owner string, limit int, lease time.Duration, filter models.ClaimFilter) (models.OrderArray, error) {
+	const op = "storage.memory.ClaimOrdersInWork"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	candidates := make([]*orderRow, 0)
+	for _, row := range m.orders {
+		if models.IsTerminalStatus(row.status) || row.deadLetteredAt != 0 {
+			continue
+		}
+		if row.nextPollAt > now || (row.lockedBy != "" && row.lockedUntil > now) {
+			continue
+		}
+		if filter.Skips(row.number, row.userID) {
+			continue
+		}
+		candidates = append(candidates, row)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].nextPollAt != candidates[j].nextPollAt {
+			return candidates[i].nextPollAt < candidates[j].nextPollAt
+		}
+		return candidates[i].id < candidates[j].id
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	orderArray := models.OrderArray{}
+	for _, row := range candidates {
+		row.lockedUntil = now + int64(lease.Seconds())
+		row.lockedBy = owner
+		orderArray = append(orderArray, row.toOrder())
+	}
+
+	if len(orderArray) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrOrdersInWorkIsEmpty)
+	}
+	return orderArray, nil
+}
+
+func (m *StoreMemory) RescheduleOrder(ctx context.Context, numOrder int64, owner string, attempts int, nextPollAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || row.lockedBy != owner {
+		return nil
+	}
+	row.attempts = attempts
+	row.nextPollAt = nextPollAt
+	row.lockedUntil = 0
+	row.lockedBy = ""
+	return nil
+}
+
+func (m *StoreMemory) UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) (models.ProcessedOrderArray, error) {
+	const op = "storage.memory.UpdateOrdersBatch"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	processed := models.ProcessedOrderArray{}
+	for _, order := range orders {
+		row, ok := m.ordersByNumber[order.OrderNum]
+		if !ok {
+			continue
+		}
+		if !models.CanTransition(row.status, order.Status) {
+			continue
+		}
+		row.status = order.Status
+		row.accrual = order.Accrual
+		if order.Status != models.StatusProcessed {
+			continue
+		}
+		row.processedAt = now
+		event := models.ProcessedOrder{
+			OrderNum:        order.OrderNum,
+			UserID:          row.userID,
+			Accrual:         order.Accrual,
+			ProcessedAt:     now,
+			Position:        m.countProcessed(row.userID),
+			LifetimeAccrual: m.lifetimeAccrual(row.userID),
+		}
+		processed = append(processed, event)
+		m.processedEvents = append(m.processedEvents, &processedEvent{order: event, nextAttemptAt: now})
+		if order.Accrual > 0 {
+			m.postLedger(models.LedgerKindAccrual, order.OrderNum, "", now,
+				posting{account: models.LedgerAccountUser, userID: row.userID, amount: order.Accrual},
+				posting{account: models.LedgerAccountAccrual, amount: -order.Accrual},
+			)
+		}
+	}
+	return processed, nil
+}
+
+func (m *StoreMemory) GetLifetimeAccrual(ctx context.Context, userID int64) (models.Money, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lifetimeAccrual(userID), nil
+}
+
+func (m *StoreMemory) lifetimeAccrual(userID int64) models.Money {
+	var lifetime models.Money
+	for _, row := range m.orders {
+		if row.userID == userID && row.status == models.StatusProcessed {
+			lifetime += row.accrual
+		}
+	}
+	return lifetime
+}
+
+func (m *StoreMemory) countProcessed(userID int64) int {
+	count := 0
+	for _, row := range m.orders {
+		if row.userID == userID && row.status == models.StatusProcessed {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *StoreMemory) ClaimProcessedOrders(ctx context.Context, limit int, now int64, lease time.Duration) (models.ProcessedOrderArray, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	claimed := models.ProcessedOrderArray{}
+	for _, event := range m.processedEvents {
+		if len(claimed) >= limit {
+			break
+		}
+		if event.nextAttemptAt > now {
+			continue
+		}
+		event.nextAttemptAt = now + int64(lease.Seconds())
+		claimed = append(claimed, event.order)
+	}
+	return claimed, nil
+}
+
+func (m *StoreMemory) AckProcessedOrder(ctx context.Context, numOrder int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.processedEvents {
+		if event.order.OrderNum == numOrder {
+			m.processedEvents = append(m.processedEvents[:i], m.processedEvents[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *StoreMemory) RetryProcessedOrder(ctx context.Context, numOrder int64, lastErr string, nextAttemptAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range m.processedEvents {
+		if event.order.OrderNum == numOrder {
+			event.order.Attempts++
+			event.lastError = lastErr
+			event.nextAttemptAt = nextAttemptAt
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *StoreMemory) AddOrderBonus(ctx context.Context, numOrder int64, userID int64, bonuses models.OrderBonusArray, created int64) error {
+	const op = "storage.memory.AddOrderBonus"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || row.userID != userID {
+		return fmt.Errorf("%s: %w", op, models.ErrOrderNotFound)
+	}
+	if row.bonuses != nil {
+		return fmt.Errorf("%s: %w", op, models.ErrBonusApplied)
+	}
+	row.bonuses = append(models.OrderBonusArray{}, bonuses...)
+
+	names := make([]string, 0, len(bonuses))
+	for _, bonus := range bonuses {
+		names = append(names, bonus.Campaign)
+	}
+	total := bonuses.Total()
+	m.postLedger(models.LedgerKindBonus, numOrder, strings.Join(names, ", "), created,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: total},
+		posting{account: models.LedgerAccountCampaign, amount: -total},
+	)
+	return nil
+}
+
+func (m *StoreMemory) AddTransfer(ctx context.Context, fromUserID int64, toUserID int64, sum models.Money, limit models.TransferLimit, since int64, created int64) (*models.Transfer, error) {
+	const op = "storage.memory.AddTransfer"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.available(fromUserID) <= sum {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
+	var count int
+	var total models.Money
+	for _, t := range m.transfers {
+		if t.FromUserID == fromUserID && t.CreatedAt >= since {
+			count++
+			total += t.Sum
+		}
+	}
+	if !limit.Allows(count, total, sum) {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTransferLimit)
+	}
+
+	transfer := models.Transfer{
+		ID:         int64(len(m.transfers)) + 1,
+		FromUserID: fromUserID,
+		FromLogin:  m.login(fromUserID),
+		ToUserID:   toUserID,
+		ToLogin:    m.login(toUserID),
+		Sum:        sum,
+		CreatedAt:  created,
+	}
+	m.transfers = append(m.transfers, transfer)
+	m.postLedger(models.LedgerKindTransfer, 0,
+		fmt.Sprintf("transfer #%d from %s to %s", transfer.ID, transfer.FromLogin, transfer.ToLogin), created,
+		posting{account: models.LedgerAccountUser, userID: fromUserID, amount: -sum},
+		posting{account: models.LedgerAccountUser, userID: toUserID, amount: sum, carry: true},
+	)
+	return &transfer, nil
+}
+
+func (m *StoreMemory) login(userID int64) string {
+	for _, user := range m.users {
+		if user.ID == userID {
+			return user.Login
+		}
+	}
+	return ""
+}
+
+func (m *StoreMemory) GetTransfers(ctx context.Context, userID int64) (models.TransferArray, error) {
+	const op = "storage.memory.GetTransfers"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transfers := models.TransferArray{}
+	for i := len(m.transfers) - 1; i >= 0; i-- {
+		t := m.transfers[i]
+		if t.FromUserID == userID || t.ToUserID == userID {
+			transfers = append(transfers, t)
+		}
+	}
+	if len(transfers) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTransfersEmpty)
+	}
+	return transfers, nil
+}
+
+func (m *StoreMemory) SetUserTier(ctx context.Context, userID int64, tier string, changedAt int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.tiers[userID]
+	m.tiers[userID] = tier
+	return previous, nil
+}
+
+func (m *StoreMemory) MarkOrderNotRegistered(ctx context.Context, numOrder int64, seenAt int64, grace time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || models.IsTerminalStatus(row.status) {
+		return nil
+	}
+	row.notRegisteredCount++
+	row.notRegisteredAt = seenAt
+	if seenAt-row.uploadedAt >= int64(grace.Seconds()) {
+		row.status = models.StatusUnknown
+	}
+	return nil
+}
+
+func (m *StoreMemory) RecordOrderFailure(ctx context.Context, numOrder int64, owner string, lastErr string, maxFailures int, nextPollAt int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || row.lockedBy != owner {
+		return false, nil
+	}
+	row.failures++
+	row.attempts++
+	row.lastError = lastErr
+	row.nextPollAt = nextPollAt
+	row.lockedUntil = 0
+	row.lockedBy = ""
+	if row.failures >= maxFailures {
+		row.deadLetteredAt = time.Now().Unix()
+		return true, nil
+	}
+	return false, nil
+}
+
+func (m *StoreMemory) GetDeadLetterOrders(ctx context.Context) (models.DeadLetterOrderArray, error) {
+	const op = "storage.memory.GetDeadLetterOrders"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orders := models.DeadLetterOrderArray{}
+	for _, row := range m.orders {
+		if row.deadLetteredAt != 0 {
+			orders = append(orders, row.toDeadLetter())
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].DeadLetteredAt < orders[j].DeadLetteredAt
+	})
+
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrDeadLetterEmpty)
+	}
+	return orders, nil
+}
+
+func (m *StoreMemory) GetDeadLetterOrder(ctx context.Context, numOrder int64) (*models.DeadLetterOrder, error) {
+	const op = "storage.memory.GetDeadLetterOrder"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || row.deadLetteredAt == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrDeadLetterNotFound)
+	}
+	order := row.toDeadLetter()
+	return &order, nil
+}
+
+func (m *StoreMemory) RequeueDeadLetterOrder(ctx context.Context, numOrder int64) error {
+	const op = "storage.memory.RequeueDeadLetterOrder"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	row, ok := m.ordersByNumber[numOrder]
+	if !ok || row.deadLetteredAt == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrDeadLetterNotFound)
+	}
+	row.deadLetteredAt = 0
+	row.failures = 0
+	row.attempts = 0
+	row.nextPollAt = 0
+	return nil
+}
+
+func (r *orderRow) toOrder() models.Order {
+	return models.Order{
+		Number:     r.number,
+		Status:     r.status,
+		Accrual:    r.accrual,
+		Bonus:      r.bonuses.Total(),
+		UploadedAt: r.uploadedAt,
+		UserID:     r.userID,
+		Attempts:   r.attempts,
+	}
+}
+
+func (r *withdrawalRow) toWithdrawals() models.Withdrawals {
+	return models.Withdrawals{
+		OrderNum:    r.number,
+		Sum:         r.sum,
+		ProcessedAt: r.processedAt,
+		ID:          r.id,
+		ReversalOf:  r.reversalOf,
+		ReversedBy:  r.reversedBy,
+		Reason:      r.reason,
+	}
+}
+
+func (r *orderRow) toDeadLetter() models.DeadLetterOrder {
+	return models.DeadLetterOrder{
+		Number:         r.number,
+		UserID:         r.userID,
+		Status:         r.status,
+		Attempts:       r.attempts,
+		Failures:       r.failures,
+		LastError:      r.lastError,
+		UploadedAt:     r.uploadedAt,
+		DeadLetteredAt: r.deadLetteredAt,
+	}
+}
+
+func (m *StoreMemory) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, expiredBefore int64) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyKey{userID: record.UserID, key: record.Key}
+	if existing, ok := m.idempotencyKeys[id]; ok && existing.CreatedAt >= expiredBefore {
+		found := *existing
+		return &found, nil
+	}
+	reserved := *record
+	reserved.Status = 0
+	reserved.ContentType = ""
+	reserved.Body = nil
+	m.idempotencyKeys[id] = &reserved
+	return nil, nil
+}
+
+func (m *StoreMemory) CompleteIdempotencyKey(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.idempotencyKeys[idempotencyKey{userID: userID, key: key}]; ok {
+		record.Status = status
+		record.ContentType = contentType
+		record.Body = append([]byte(nil), body...)
+	}
+	return nil
+}
+
+func (m *StoreMemory) ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyKey{userID: userID, key: key}
+	if record, ok := m.idempotencyKeys[id]; ok && !record.Completed() {
+		delete(m.idempotencyKeys, id)
+	}
+	return nil
+}
+
+func (m *StoreMemory) PurgeIdempotencyKeys(ctx context.Context, before int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, record := range m.idempotencyKeys {
+		if record.CreatedAt < before {
+			delete(m.idempotencyKeys, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *StoreMemory) RememberCallbackSignature(ctx context.Context, signature string, expiresAt int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.callbackSignatures[signature]; ok {
+		return false, nil
+	}
+	m.callbackSignatures[signature] = expiresAt
+	return true, nil
+}
+
+func (m *StoreMemory) PurgeCallbackSignatures(ctx context.Context, before int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for signature, expiresAt := range m.callbackSignatures {
+		if expiresAt < before {
+			delete(m.callbackSignatures, signature)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/pressly/goose/v3"
+)
+
+const pointLotsVersion = 20251213100000
+
+// pointLotsMigration creates point_lots and splits every positive balance
+// into lots. It is a Go migration because expiry depends on the configured
+// points lifetime.
+func pointLotsMigration(lifetimeMonths int) *goose.Migration {
+	return goose.NewGoMigration(pointLotsVersion,
+		&goose.GoFunc{RunTx: func(ctx context.Context, tx *sql.Tx) error {
+			return upPointLots(ctx, tx, lifetimeMonths)
+		}},
+		&goose.GoFunc{RunTx: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "drop table if exists point_lots;")
+			return err
+		}},
+	)
+}
+
+func upPointLots(ctx context.Context, tx *sql.Tx, lifetimeMonths int) error {
+	_, err := tx.ExecContext(ctx, `
+									create table if not exists point_lots
+									(
+									    id           bigserial primary key,
+									    user_id      bigint         not null references users (id),
+									    source       text           not null,
+									    order_number bigint         default null,
+									    amount       numeric(20, 2) not null,
+									    remaining    numeric(20, 2) not null,
+									    earned_at    bigint         not null,
+									    expires_at   bigint         default null,
+									    constraint point_lots_remaining check (remaining >= 0 and remaining <= amount)
+									);
+
+									create index if not exists point_lots_user_idx on point_lots (user_id, expires_at, id)
+									    where remaining > 0;
+
+									create index if not exists point_lots_expiry_idx on point_lots (expires_at)
+									    where remaining > 0;`)
+	if err != nil {
+		return err
+	}
+
+	// Every credit in the ledger becomes a lot earned when it was posted: an
+	// accrual is posted when its order is processed, and the ledger backfill
+	// dated older accruals by uploaded_at. What the user has spent since is
+	// taken from the oldest credits first, and anything the ledger cannot
+	// account for becomes a lot earned now.
+	rows, err := tx.QueryContext(ctx, `
+									with credits as (select user_id, kind, order_number, amount, created_at,
+									                        sum(amount) over (partition by user_id order by created_at, id) as running,
+									                        sum(amount) over (partition by user_id) as total
+									                 from ledger_entries
+									                 where account = 'user' and amount > 0)
+									select c.user_id, c.kind, c.order_number, c.amount,
+									       least(c.amount, c.running - (c.total - b."current")), c.created_at
+									from credits c
+									join user_balances b on b.user_id = c.user_id
+									where b."current" > 0
+									  and c.running - (c.total - b."current") > 0
+									union all
+									select b.user_id, 'MIGRATION', null, b."current" - coalesce(t.total, 0),
+									       b."current" - coalesce(t.total, 0), $1::bigint
+									from user_balances b
+									left join (select user_id, sum(amount) as total
+									           from ledger_entries
+									           where account = 'user' and amount > 0
+									           group by user_id) t on t.user_id = b.user_id
+									where b."current" > coalesce(t.total, 0);`, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	lots := make([]models.PointLot, 0)
+	for rows.Next() {
+		var lot models.PointLot
+		var number sql.NullInt64
+		if err := rows.Scan(&lot.UserID, &lot.Source, &number, &lot.Amount, &lot.Remaining, &lot.EarnedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		lot.OrderNum = number.Int64
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		number := sql.NullInt64{Int64: lot.OrderNum, Valid: lot.OrderNum != 0}
+		expires := sql.NullInt64{Int64: models.PointsExpireAt(lot.EarnedAt, lifetimeMonths)}
+		expires.Valid = expires.Int64 != 0
+		_, err := tx.ExecContext(ctx, `
+									insert into point_lots (user_id, source, order_number, amount, remaining, earned_at, expires_at)
+									values ($1, $2, $3, $4, $5, $6, $7);`,
+			lot.UserID, lot.Source, number, lot.Amount, lot.Remaining, lot.EarnedAt, expires)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table orders
+    add column if not exists not_registered_count int not null default 0,
+    add column if not exists not_registered_at    bigint default null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table orders
+    drop column not_registered_count,
+    drop column not_registered_at;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+update orders set status = 'PROCESSING' where status = 'REGISTERED';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+select 1;
+-- +goose StatementEnd
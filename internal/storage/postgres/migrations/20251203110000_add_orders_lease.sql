@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table orders
+    add column if not exists locked_until bigint default null,
+    add column if not exists locked_by    text default null;
+
+create index if not exists orders_in_work_idx on orders (locked_until)
+    where status not in ('INVALID', 'PROCESSED', 'UNKNOWN');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists orders_in_work_idx;
+alter table orders
+    drop column locked_until,
+    drop column locked_by;
+-- +goose StatementEnd
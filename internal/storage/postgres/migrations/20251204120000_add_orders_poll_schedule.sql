@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table orders
+    add column if not exists next_poll_at bigint not null default 0,
+    add column if not exists attempts     int not null default 0;
+
+drop index if exists orders_in_work_idx;
+create index if not exists orders_in_work_idx on orders (next_poll_at)
+    where status not in ('INVALID', 'PROCESSED', 'UNKNOWN');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists orders_in_work_idx;
+create index if not exists orders_in_work_idx on orders (locked_until)
+    where status not in ('INVALID', 'PROCESSED', 'UNKNOWN');
+alter table orders
+    drop column next_poll_at,
+    drop column attempts;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table orders
+    add column if not exists failures         int not null default 0,
+    add column if not exists last_error       text default null,
+    add column if not exists dead_lettered_at bigint default null;
+
+create index if not exists orders_dead_letter_idx on orders (dead_lettered_at)
+    where dead_lettered_at is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists orders_dead_letter_idx;
+alter table orders
+    drop column failures,
+    drop column last_error,
+    drop column dead_lettered_at;
+-- +goose StatementEnd
@@ -0,0 +1,101 @@
+-- +goose Up
+-- +goose StatementBegin
+drop view if exists balance;
+
+alter table orders
+    alter column accrual type numeric(20, 2) using round(accrual::numeric, 2);
+alter table withdrawal_accruals
+    alter column sum type numeric(20, 2) using round(sum::numeric, 2);
+
+create or replace view balance as (
+with
+    withdrawn as (select
+				    w.user_id,
+					sum(COALESCE(w.sum, 0)) as withdrawn
+				  from withdrawal_accruals w
+				  group by w.user_id),
+	accrual as (select
+				    o.user_id,
+					sum(COALESCE(o.accrual, 0)) as accrual
+				from orders o
+				group by o.user_id)
+
+select
+    a.user_id,
+	a.accrual - COALESCE(w.withdrawn, 0) as current,
+	COALESCE(w.withdrawn, 0) as withdrawn
+from accrual a
+left join withdrawn w on w.user_id = a.user_id);
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+	order_id bigint;
+begin
+SELECT "current" INTO current_balance
+FROM balance
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+ELSE
+	INSERT INTO orders (number, user_id, uploaded_at)
+    VALUES (NEW.order_id, NEW.user_id, NEW.processed_at) RETURNING id INTO order_id;
+	NEW.order_id = order_id;
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop view if exists balance;
+
+alter table orders
+    alter column accrual type float8;
+alter table withdrawal_accruals
+    alter column sum type float8;
+
+create or replace view balance as (
+with
+    withdrawn as (select
+				    w.user_id,
+					sum(COALESCE(w.sum, 0)) as withdrawn
+				  from withdrawal_accruals w
+				  group by w.user_id),
+	accrual as (select
+				    o.user_id,
+					sum(COALESCE(o.accrual, 0)) as accrual
+				from orders o
+				group by o.user_id)
+
+select
+    a.user_id,
+	a.accrual - COALESCE(w.withdrawn, 0) as current,
+	COALESCE(w.withdrawn, 0) as withdrawn
+from accrual a
+left join withdrawn w on w.user_id = a.user_id);
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance float8;
+	order_id bigint;
+begin
+SELECT "current" INTO current_balance
+FROM balance
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+ELSE
+	INSERT INTO orders (number, user_id, uploaded_at)
+    VALUES (NEW.order_id, NEW.user_id, NEW.processed_at) RETURNING id INTO order_id;
+	NEW.order_id = order_id;
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
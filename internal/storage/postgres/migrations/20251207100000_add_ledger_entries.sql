@@ -0,0 +1,122 @@
+-- +goose Up
+-- +goose StatementBegin
+create sequence if not exists ledger_tx_seq;
+
+create table if not exists ledger_entries
+(
+    id           bigserial primary key,
+    tx_id        bigint         not null,
+    account      text           not null,
+    user_id      bigint         references users (id),
+    kind         text           not null,
+    amount       numeric(20, 2) not null,
+    order_number bigint         default null,
+    description  text           default null,
+    created_at   bigint         not null,
+    constraint ledger_entries_user_account check ((account = 'user') = (user_id is not null))
+);
+
+create index if not exists ledger_entries_user_idx on ledger_entries (user_id, id)
+    where user_id is not null;
+create index if not exists ledger_entries_tx_idx on ledger_entries (tx_id);
+
+create or replace function forbid_ledger_change()
+returns trigger as $$
+begin
+    raise exception 'ledger entries are immutable';
+end;
+$$ language plpgsql;
+
+create or replace trigger ledger_entries_immutable
+before update or delete on ledger_entries
+for each row execute function forbid_ledger_change();
+
+create or replace function check_ledger_balanced()
+returns trigger as $$
+declare
+    total numeric(20, 2);
+begin
+SELECT sum(amount) INTO total
+FROM ledger_entries
+WHERE tx_id = NEW.tx_id;
+if total <> 0 then
+    raise exception 'ledger transaction % is not balanced', NEW.tx_id;
+end if;
+return null;
+end;
+$$ language plpgsql;
+
+create constraint trigger ledger_entries_balanced
+after insert on ledger_entries
+deferrable initially deferred
+for each row execute function check_ledger_balanced();
+
+with accruals as (select
+                      nextval('ledger_tx_seq') as tx_id,
+                      o.user_id,
+                      o.number,
+                      o.accrual,
+                      o.uploaded_at
+                  from orders o
+                  where o.status = 'PROCESSED' and o.accrual > 0)
+insert into ledger_entries (tx_id, account, user_id, kind, amount, order_number, created_at)
+select tx_id, 'user', user_id, 'ACCRUAL', accrual, number, uploaded_at from accruals
+union all
+select tx_id, 'system:accrual', null, 'ACCRUAL', -accrual, number, uploaded_at from accruals;
+
+with withdrawals as (select
+                         nextval('ledger_tx_seq') as tx_id,
+                         w.user_id,
+                         o.number,
+                         w.sum,
+                         w.processed_at
+                     from withdrawal_accruals w
+                     left join orders o on o.id = w.order_id)
+insert into ledger_entries (tx_id, account, user_id, kind, amount, order_number, created_at)
+select tx_id, 'user', user_id, 'WITHDRAWAL', -sum, number, processed_at from withdrawals
+union all
+select tx_id, 'system:withdrawal', null, 'WITHDRAWAL', sum, number, processed_at from withdrawals;
+
+drop view if exists balance;
+
+create or replace view balance as (
+select
+    l.user_id,
+    sum(l.amount) as current,
+    -sum(case when l.kind in ('WITHDRAWAL', 'REVERSAL') then l.amount else 0 end) as withdrawn
+from ledger_entries l
+where l.account = 'user'
+group by l.user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop view if exists balance;
+
+create or replace view balance as (
+with
+    withdrawn as (select
+				    w.user_id,
+					sum(COALESCE(w.sum, 0)) as withdrawn
+				  from withdrawal_accruals w
+				  group by w.user_id),
+	accrual as (select
+				    o.user_id,
+					sum(COALESCE(o.accrual, 0)) as accrual
+				from orders o
+				group by o.user_id)
+
+select
+    a.user_id,
+	a.accrual - COALESCE(w.withdrawn, 0) as current,
+	COALESCE(w.withdrawn, 0) as withdrawn
+from accrual a
+left join withdrawn w on w.user_id = a.user_id);
+
+drop trigger if exists ledger_entries_balanced on ledger_entries;
+drop trigger if exists ledger_entries_immutable on ledger_entries;
+drop function if exists check_ledger_balanced();
+drop function if exists forbid_ledger_change();
+drop table if exists ledger_entries;
+drop sequence if exists ledger_tx_seq;
+-- +goose StatementEnd
@@ -0,0 +1,82 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists user_balances
+(
+    user_id    bigint primary key references users (id),
+    current    numeric(20, 2) not null default 0,
+    withdrawn  numeric(20, 2) not null default 0,
+    updated_at bigint         not null default 0
+);
+
+insert into user_balances (user_id, current, withdrawn, updated_at)
+select
+    l.user_id,
+    sum(l.amount),
+    -sum(case when l.kind in ('WITHDRAWAL', 'REVERSAL') then l.amount else 0 end),
+    max(l.created_at)
+from ledger_entries l
+where l.account = 'user'
+group by l.user_id
+on conflict (user_id) do nothing;
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+	order_id bigint;
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+ELSE
+	INSERT INTO orders (number, user_id, uploaded_at)
+    VALUES (NEW.order_id, NEW.user_id, NEW.processed_at) RETURNING id INTO order_id;
+	NEW.order_id = order_id;
+end if;
+return new;
+end;
+$$ language plpgsql;
+
+drop view if exists balance;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create or replace view balance as (
+select
+    l.user_id,
+    sum(l.amount) as current,
+    -sum(case when l.kind in ('WITHDRAWAL', 'REVERSAL') then l.amount else 0 end) as withdrawn
+from ledger_entries l
+where l.account = 'user'
+group by l.user_id);
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+	order_id bigint;
+begin
+SELECT "current" INTO current_balance
+FROM balance
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+ELSE
+	INSERT INTO orders (number, user_id, uploaded_at)
+    VALUES (NEW.order_id, NEW.user_id, NEW.processed_at) RETURNING id INTO order_id;
+	NEW.order_id = order_id;
+end if;
+return new;
+end;
+$$ language plpgsql;
+
+drop table if exists user_balances;
+-- +goose StatementEnd
@@ -0,0 +1,88 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table withdrawal_accruals
+    add column if not exists number bigint;
+
+update withdrawal_accruals w
+set number = o.number
+from orders o
+where o.id = w.order_id;
+
+update withdrawal_accruals
+set number = order_id
+where number is null;
+
+delete from orders o
+using withdrawal_accruals w
+where o.id = w.order_id
+  and COALESCE(o.accrual, 0) = 0;
+
+alter table withdrawal_accruals
+    alter column number set not null,
+    add constraint withdrawal_accruals_number_key unique (number),
+    drop column order_id;
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table withdrawal_accruals
+    add column if not exists order_id bigint;
+
+insert into orders (number, user_id, uploaded_at)
+select w.number, w.user_id, w.processed_at
+from withdrawal_accruals w
+on conflict (number) do nothing;
+
+update withdrawal_accruals w
+set order_id = o.id
+from orders o
+where o.number = w.number;
+
+alter table withdrawal_accruals
+    alter column order_id set not null,
+    drop constraint withdrawal_accruals_number_key,
+    drop column number;
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+	order_id bigint;
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+ELSE
+	INSERT INTO orders (number, user_id, uploaded_at)
+    VALUES (NEW.order_id, NEW.user_id, NEW.processed_at) RETURNING id INTO order_id;
+	NEW.order_id = order_id;
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists idempotency_keys
+(
+    user_id      bigint not null references users (id),
+    key          text   not null,
+    method       text   not null,
+    path         text   not null,
+    fingerprint  text   not null,
+    status       int    default null,
+    content_type text   default null,
+    body         bytea  default null,
+    created_at   bigint not null,
+    primary key (user_id, key)
+);
+
+create index if not exists idempotency_keys_created_idx on idempotency_keys (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists idempotency_keys;
+-- +goose StatementEnd
@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists withdrawal_reservations
+(
+    id          bigserial primary key,
+    user_id     bigint         not null references users (id),
+    number      bigint         not null unique,
+    sum         numeric(20, 2) not null,
+    status      text           not null default 'RESERVED',
+    created_at  bigint         not null,
+    expires_at  bigint         not null,
+    resolved_at bigint         default null
+);
+
+create index if not exists withdrawal_reservations_expiry_idx on withdrawal_reservations (expires_at)
+    where status = 'RESERVED';
+
+alter table user_balances
+    add column if not exists reserved numeric(20, 2) not null default 0;
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" - reserved INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+end if;
+return new;
+end;
+$$ language plpgsql;
+
+alter table user_balances
+    drop column reserved;
+
+drop table if exists withdrawal_reservations;
+-- +goose StatementEnd
@@ -0,0 +1,77 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table withdrawal_accruals
+    add column if not exists reversal_of bigint default null references withdrawal_accruals (id),
+    add column if not exists reversed_by text   default null,
+    add column if not exists reason      text   default null;
+
+alter table withdrawal_accruals
+    drop constraint withdrawal_accruals_number_key;
+
+create unique index if not exists withdrawal_accruals_number_key on withdrawal_accruals (number)
+    where reversal_of is null;
+create index if not exists withdrawal_accruals_reversal_idx on withdrawal_accruals (reversal_of)
+    where reversal_of is not null;
+
+alter table withdrawal_accruals
+    add constraint withdrawal_accruals_sum_sign
+        check ((reversal_of is null and sum > 0) or (reversal_of is not null and sum < 0)) not valid;
+
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+begin
+if new.reversal_of is not null then
+    return new;
+end if;
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" - reserved INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+end if;
+return new;
+end;
+$$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+create or replace function check_balance_user()
+returns trigger as $$
+declare
+    current_balance numeric(20, 2);
+begin
+INSERT INTO user_balances (user_id)
+VALUES (NEW.user_id)
+ON CONFLICT (user_id) DO NOTHING;
+SELECT "current" - reserved INTO current_balance
+FROM user_balances
+WHERE user_id = NEW.user_id
+    FOR UPDATE;
+if COALESCE(current_balance, 0) <= new.sum then
+    raise exception 'there are not enough bonuses to deduct';
+end if;
+return new;
+end;
+$$ language plpgsql;
+
+delete from withdrawal_accruals where reversal_of is not null;
+
+alter table withdrawal_accruals
+    drop constraint if exists withdrawal_accruals_sum_sign;
+
+drop index if exists withdrawal_accruals_reversal_idx;
+drop index if exists withdrawal_accruals_number_key;
+
+alter table withdrawal_accruals
+    add constraint withdrawal_accruals_number_key unique (number),
+    drop column reversal_of,
+    drop column reversed_by,
+    drop column reason;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists user_tiers
+(
+    user_id    bigint primary key references users (id),
+    tier       text   not null,
+    updated_at bigint not null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists user_tiers;
+-- +goose StatementEnd
@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users
+    add column if not exists created_at bigint;
+
+-- Accounts older than this migration date from their first order; those
+-- without one get 0, which no new-user campaign accepts.
+update users u
+set created_at = coalesce((select min(o.uploaded_at) from orders o where o.user_id = u.id), 0)
+where u.created_at is null;
+
+alter table users
+    alter column created_at set default extract(epoch from now())::bigint,
+    alter column created_at set not null;
+
+alter table orders
+    add column if not exists bonus        numeric(20, 2) default null,
+    add column if not exists processed_at bigint         default null;
+
+update orders o
+set processed_at = coalesce(
+        (select min(l.created_at)
+         from ledger_entries l
+         where l.kind = 'ACCRUAL' and l.order_number = o.number and l.account = 'user'),
+        o.uploaded_at)
+where o.status = 'PROCESSED';
+
+create table if not exists order_bonuses
+(
+    id           bigserial primary key,
+    order_number bigint         not null references orders (number),
+    campaign     text           not null,
+    amount       numeric(20, 2) not null,
+    created_at   bigint         not null,
+    unique (order_number, campaign)
+);
+
+create table if not exists processed_order_events
+(
+    order_number    bigint primary key references orders (number),
+    user_id         bigint         not null references users (id),
+    accrual         numeric(20, 2) not null,
+    processed_at    bigint         not null,
+    position        integer        not null,
+    attempts        integer        not null default 0,
+    next_attempt_at bigint         not null,
+    last_error      text           default null
+);
+
+create index if not exists processed_order_events_next_idx on processed_order_events (next_attempt_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists processed_order_events;
+
+drop table if exists order_bonuses;
+
+alter table orders
+    drop column processed_at,
+    drop column bonus;
+
+alter table users
+    drop column created_at;
+-- +goose StatementEnd
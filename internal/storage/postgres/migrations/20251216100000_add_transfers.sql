@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists transfers
+(
+    id           bigserial primary key,
+    from_user_id bigint         not null references users (id),
+    to_user_id   bigint         not null references users (id),
+    sum          numeric(20, 2) not null,
+    created_at   bigint         not null,
+    constraint transfers_positive check (sum > 0),
+    constraint transfers_distinct check (from_user_id <> to_user_id)
+);
+
+create index if not exists transfers_from_idx on transfers (from_user_id, created_at);
+create index if not exists transfers_to_idx on transfers (to_user_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists transfers;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users
+    add column if not exists referral_code text,
+    add column if not exists referred_by   bigint default null references users (id);
+
+update users
+set referral_code = upper(substr(md5(random()::text || id::text), 1, 10))
+where referral_code is null;
+
+alter table users
+    alter column referral_code set not null;
+
+create unique index if not exists users_referral_code_idx on users (referral_code);
+
+alter table users
+    add constraint users_referred_by_older check (referred_by < id);
+
+create table if not exists referral_rewards
+(
+    referred_user_id bigint primary key references users (id),
+    referrer_id      bigint         not null references users (id),
+    order_number     bigint         not null references orders (number),
+    referrer_bonus   numeric(20, 2) not null,
+    referee_bonus    numeric(20, 2) not null,
+    created_at       bigint         not null
+);
+
+create index if not exists referral_rewards_referrer_idx on referral_rewards (referrer_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists referral_rewards;
+
+alter table users
+    drop constraint if exists users_referred_by_older;
+
+drop index if exists users_referral_code_idx;
+
+alter table users
+    drop column referred_by,
+    drop column referral_code;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists point_lot_spends
+(
+    id       bigserial primary key,
+    tx_id    bigint         not null,
+    lot_id   bigint         not null references point_lots (id),
+    amount   numeric(20, 2) not null,
+    restored numeric(20, 2) not null default 0,
+    constraint point_lot_spends_positive check (amount > 0),
+    constraint point_lot_spends_restored check (restored >= 0 and restored <= amount)
+);
+
+create index if not exists point_lot_spends_tx_idx on point_lot_spends (tx_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists point_lot_spends;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists accrual_callback_signatures
+(
+    signature  text   primary key,
+    expires_at bigint not null
+);
+
+create index if not exists accrual_callback_signatures_expires_idx on accrual_callback_signatures (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists accrual_callback_signatures;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table processed_order_events
+    add column if not exists lifetime_accrual numeric(20, 2) not null default 0;
+
+update processed_order_events e
+set lifetime_accrual = (select coalesce(sum(o.accrual), 0)
+                        from orders o
+                        where o.user_id = e.user_id
+                          and o.status = 'PROCESSED'
+                          and o.processed_at <= e.processed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table processed_order_events
+    drop column lifetime_accrual;
+-- +goose StatementEnd
@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/pressly/goose/v3"
+)
+
+// testDB opens DATABASE_URI with search_path pointing at a fresh schema that
+// is dropped when the test ends.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("DATABASE_URI")
+	if dsn == "" {
+		t.Skip("DATABASE_URI is not set")
+	}
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("gophermart_migrations_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("create schema " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("drop schema " + schema + " cascade"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if u, err := url.Parse(dsn); err == nil && strings.Contains(dsn, "://") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestPointLotsMigrationBackfill(t *testing.T) {
+	for _, months := range []int{12, 0} {
+		t.Run(fmt.Sprintf("lifetime %d", months), func(t *testing.T) {
+			db := testDB(t)
+			ctx := context.Background()
+			fsys, err := fs.Sub(migrations, "migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+			provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys,
+				goose.WithGoMigrations(pointLotsMigration(months)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := provider.UpTo(ctx, pointLotsVersion-1); err != nil {
+				t.Fatal(err)
+			}
+
+			var userID int64
+			if err := db.QueryRow("insert into users (login, pass_hash) values ('legacy', 'hash') returning id").Scan(&userID); err != nil {
+				t.Fatal(err)
+			}
+			earned := []int64{1700000000, 1710000000}
+			_, err = db.Exec(`
+				insert into ledger_entries (tx_id, account, user_id, kind, amount, order_number, created_at)
+				values (1, 'user', $1, 'ACCRUAL', 100, 12345678903, $2),
+				       (1, 'system:accrual', null, 'ACCRUAL', -100, 12345678903, $2),
+				       (2, 'user', $1, 'ACCRUAL', 50, 79927398713, $3),
+				       (2, 'system:accrual', null, 'ACCRUAL', -50, 79927398713, $3),
+				       (3, 'user', $1, 'WITHDRAWAL', -120, 2377225624, $4),
+				       (3, 'system:withdrawal', null, 'WITHDRAWAL', 120, 2377225624, $4);`,
+				userID, earned[0], earned[1], earned[1]+100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec("insert into user_balances (user_id, current, withdrawn) values ($1, 30, 120)", userID); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := provider.Up(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, err := db.Query("select source, order_number, amount, remaining, earned_at, expires_at from point_lots where user_id = $1", userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			lots := make([]models.PointLot, 0)
+			for rows.Next() {
+				var lot models.PointLot
+				var expires sql.NullInt64
+				if err := rows.Scan(&lot.Source, &lot.OrderNum, &lot.Amount, &lot.Remaining, &lot.EarnedAt, &expires); err != nil {
+					t.Fatal(err)
+				}
+				lot.ExpiresAt = expires.Int64
+				lots = append(lots, lot)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := models.PointLot{
+				Source:    models.LedgerKindAccrual,
+				OrderNum:  79927398713,
+				Amount:    5000,
+				Remaining: 3000,
+				EarnedAt:  earned[1],
+				ExpiresAt: models.PointsExpireAt(earned[1], months),
+			}
+			if len(lots) != 1 || lots[0] != want {
+				t.Fatalf("lots: got %+v, want %+v", lots, want)
+			}
+		})
+	}
+}
+
+func TestOrderBonusesMigrationBackfill(t *testing.T) {
+	const version = 20251215100000
+
+	db := testDB(t)
+	ctx := context.Background()
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys,
+		goose.WithGoMigrations(pointLotsMigration(config.DefaultPointsLifetimeMonths)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.UpTo(ctx, version-1); err != nil {
+		t.Fatal(err)
+	}
+
+	var shopper, idle int64
+	if err := db.QueryRow("insert into users (login, pass_hash) values ('shopper', 'hash') returning id").Scan(&shopper); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("insert into users (login, pass_hash) values ('idle', 'hash') returning id").Scan(&idle); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		insert into orders (number, status, accrual, uploaded_at, user_id)
+		values (12345678903, 'PROCESSED', 100, 1700000000, $1),
+		       (79927398713, 'NEW', null, 1690000000, $1);`, shopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		insert into ledger_entries (tx_id, account, user_id, kind, amount, order_number, created_at)
+		values (1, 'user', $1, 'ACCRUAL', 100, 12345678903, 1700000100),
+		       (1, 'system:accrual', null, 'ACCRUAL', -100, 12345678903, 1700000100);`, shopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.UpTo(ctx, version); err != nil {
+		t.Fatal(err)
+	}
+
+	for userID, want := range map[int64]int64{shopper: 1690000000, idle: 0} {
+		var created int64
+		if err := db.QueryRow("select created_at from users where id = $1", userID).Scan(&created); err != nil {
+			t.Fatal(err)
+		}
+		if created != want {
+			t.Errorf("user %d created_at: got %d, want %d", userID, created, want)
+		}
+	}
+	var processed sql.NullInt64
+	if err := db.QueryRow("select processed_at from orders where number = 12345678903").Scan(&processed); err != nil {
+		t.Fatal(err)
+	}
+	if processed.Int64 != 1700000100 {
+		t.Errorf("processed_at: got %+v, want 1700000100", processed)
+	}
+
+	var created int64
+	if err := db.QueryRow("insert into users (login, pass_hash) values ('newcomer', 'hash') returning created_at").Scan(&created); err != nil {
+		t.Fatal(err)
+	}
+	if now := time.Now().Unix(); created < now-60 || created > now+60 {
+		t.Errorf("new user created_at: got %d, want about %d", created, now)
+	}
+}
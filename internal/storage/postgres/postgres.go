@@ -6,7 +6,9 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,13 +19,14 @@ import (
 )
 
 type StorePostgres struct {
-	db *sql.DB
+	db             *sql.DB
+	pointsLifetime int
 }
 
 //go:embed migrations/*.sql
 var migrations embed.FS
 
-func NewPostgresStore(ctx context.Context, connectionString string) (*StorePostgres, error) {
+func NewPostgresStore(ctx context.Context, connectionString string, pointsLifetimeMonths int) (*StorePostgres, error) {
 	const op = "storage.postgres.NewPostgresStore"
 
 	db, err := sql.Open("pgx", connectionString)
@@ -35,63 +38,179 @@ func NewPostgresStore(ctx context.Context, connectionString string) (*StorePostg
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys,
+		goose.WithGoMigrations(pointLotsMigration(pointsLifetimeMonths)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 	nCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	goose.SetBaseFS(migrations)
-	if err := goose.UpContext(nCtx, db, "migrations"); err != nil {
+	if _, err := provider.Up(nCtx); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	return &StorePostgres{db: db}, nil
+	return &StorePostgres{db: db, pointsLifetime: pointsLifetimeMonths}, nil
 }
 
 func (pg *StorePostgres) Close() error {
 	return pg.db.Close()
 }
 
-func (pg *StorePostgres) SaveUser(ctx context.Context, login string, passHash []byte) (*models.User, error) {
-	const op = "storage.postgres.SaveUser"
+const userColumns = "id, login, pass_hash, created_at, referral_code, referred_by"
+
+func scanUser(row *sql.Row) (*models.User, error) {
 	var user models.User
-	stmt, err := pg.db.Prepare("INSERT INTO users (login, pass_hash) VALUES ($1, $2) RETURNING id, login, pass_hash")
+	var referredBy sql.NullInt64
+	if err := row.Scan(&user.ID, &user.Login, &user.PassHash, &user.CreatedAt, &user.ReferralCode, &referredBy); err != nil {
+		return &models.User{}, err
+	}
+	user.ReferredBy = referredBy.Int64
+	return &user, nil
+}
+
+func (pg *StorePostgres) SaveUser(ctx context.Context, login string, passHash []byte, referralCode string, referredBy int64) (*models.User, error) {
+	const op = "storage.postgres.SaveUser"
+	stmt, err := pg.db.Prepare("INSERT INTO users (login, pass_hash, referral_code, referred_by) VALUES ($1, $2, $3, $4) RETURNING " + userColumns)
 
 	if err != nil {
 		return &models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = stmt.QueryRowContext(ctx, login, passHash).Scan(&user.ID, &user.Login, &user.PassHash)
+	referrer := sql.NullInt64{Int64: referredBy, Valid: referredBy != 0}
+	user, err := scanUser(stmt.QueryRowContext(ctx, login, passHash, referralCode, referrer))
 
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			if pgErr.Code == "23505" {
+				if pgErr.ConstraintName == "users_referral_code_idx" {
+					return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrReferralCodeTaken)
+				}
 				return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserExists)
 			}
 		}
 		return &models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (pg *StorePostgres) User(ctx context.Context, login string) (*models.User, error) {
 	const op = "storage.postgres.User"
 
-	stmt, err := pg.db.Prepare("SELECT id, login, pass_hash FROM users WHERE login = $1")
+	stmt, err := pg.db.Prepare("SELECT " + userColumns + " FROM users WHERE login = $1")
+	if err != nil {
+		return &models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := scanUser(stmt.QueryRowContext(ctx, login))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
 		return &models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	row := stmt.QueryRowContext(ctx, login)
+	return user, nil
+}
 
-	var user models.User
-	err = row.Scan(&user.ID, &user.Login, &user.PassHash)
+func (pg *StorePostgres) UserByID(ctx context.Context, userID int64) (*models.User, error) {
+	const op = "storage.postgres.UserByID"
+
+	user, err := scanUser(pg.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
 		}
 		return &models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
+	return user, nil
+}
 
-	return &user, nil
+func (pg *StorePostgres) UserByReferralCode(ctx context.Context, code string) (*models.User, error) {
+	const op = "storage.postgres.UserByReferralCode"
+
+	user, err := scanUser(pg.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE referral_code = $1", code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &models.User{}, fmt.Errorf("%s: %w", op, models.ErrInvalidReferralCode)
+		}
+		return &models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+func (pg *StorePostgres) AddReferralReward(ctx context.Context, reward models.ReferralReward) error {
+	const op = "storage.postgres.AddReferralReward"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+									insert into referral_rewards (referred_user_id, referrer_id, order_number, referrer_bonus, referee_bonus, created_at)
+									values ($1, $2, $3, $4, $5, $6)
+									on conflict (referred_user_id) do nothing;`,
+		reward.ReferredUserID, reward.ReferrerID, reward.OrderNum, reward.ReferrerBonus, reward.RefereeBonus, reward.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrReferralRewarded)
+	}
+
+	if err := pg.postLedger(ctx, tx, models.LedgerKindReferral, reward.OrderNum, "referral bonus", reward.CreatedAt, referralPostings(reward)...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func referralPostings(reward models.ReferralReward) []posting {
+	postings := make([]posting, 0, 3)
+	if reward.RefereeBonus > 0 {
+		postings = append(postings, posting{account: models.LedgerAccountUser, userID: reward.ReferredUserID, amount: reward.RefereeBonus})
+	}
+	if reward.ReferrerBonus > 0 {
+		postings = append(postings, posting{account: models.LedgerAccountUser, userID: reward.ReferrerID, amount: reward.ReferrerBonus})
+	}
+	return append(postings, posting{account: models.LedgerAccountReferral, amount: -(reward.RefereeBonus + reward.ReferrerBonus)})
+}
+
+func (pg *StorePostgres) GetReferralStats(ctx context.Context, userID int64) (*models.ReferralStats, error) {
+	const op = "storage.postgres.GetReferralStats"
+
+	var stats models.ReferralStats
+	err := pg.db.QueryRowContext(ctx, `
+									select u.referral_code,
+									       (select count(*) from users where referred_by = u.id),
+									       (select count(*) from referral_rewards where referrer_id = u.id),
+									       (select coalesce(sum(referrer_bonus), 0) from referral_rewards where referrer_id = u.id)
+									from users u
+									where u.id = $1;`, userID).Scan(&stats.Code, &stats.Referred, &stats.Rewarded, &stats.Earned)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &stats, nil
 }
 
 func (pg *StorePostgres) AddOrder(ctx context.Context, numOrder int64, uploaded int64, userID int64) error {
@@ -130,7 +249,7 @@ func (pg *StorePostgres) AddOrder(ctx context.Context, numOrder int64, uploaded
 
 func (pg *StorePostgres) GetOrder(ctx context.Context, userID int64) (models.OrderArray, error) {
 	const op = "storage.postgres.GetOrder"
-	stmt, err := pg.db.Prepare("select number, status, accrual, uploaded_at from orders where user_id = $1 order by uploaded_at desc")
+	stmt, err := pg.db.Prepare("select number, status, accrual, bonus, uploaded_at from orders where user_id = $1 order by uploaded_at desc")
 
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -150,14 +269,12 @@ func (pg *StorePostgres) GetOrder(ctx context.Context, userID int64) (models.Ord
 	for rows.Next() {
 		var order models.Order
 		var status sql.NullString
-		var accrual sql.NullFloat64
 
-		if err := rows.Scan(&order.Number, &status, &accrual, &order.UploadedAt); err != nil {
+		if err := rows.Scan(&order.Number, &status, &order.Accrual, &order.Bonus, &order.UploadedAt); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 
 		order.Status = status.String
-		order.Accrual = accrual.Float64
 		orderArray = append(orderArray, order)
 	}
 
@@ -166,42 +283,44 @@ func (pg *StorePostgres) GetOrder(ctx context.Context, userID int64) (models.Ord
 	}
 
 	if len(orderArray) == 0 {
-		return nil, fmt.Errorf("%s: %w", op, models.ErrOrderExistsOtherUser)
+		return nil, fmt.Errorf("%s: %w", op, models.ErrOrderEmpty)
 	}
 	return orderArray, nil
 }
 
 func (pg *StorePostgres) GetBalance(ctx context.Context, userID int64) (*models.Balance, error) {
 	const op = "storage.postgres.GetBalance"
-	stmt, err := pg.db.Prepare("select current, withdrawn from balance where user_id = $1")
+	stmt, err := pg.db.Prepare("select current - reserved, withdrawn, reserved from user_balances where user_id = $1")
 
 	if err != nil {
 		return &models.Balance{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	var current, withdrawn sql.NullFloat64
-	err = stmt.QueryRowContext(ctx, userID).Scan(&current, &withdrawn)
+	balance := &models.Balance{}
+	err = stmt.QueryRowContext(ctx, userID).Scan(&balance.Current, &balance.Withdrawn, &balance.Reserved)
 
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &models.Balance{}, nil
+		}
 		return &models.Balance{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	balance := &models.Balance{}
-	balance.Current = current.Float64
-	balance.Withdrawn = withdrawn.Float64
-
 	return balance, nil
 }
 
 func (pg *StorePostgres) GetWithdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error) {
 	const op = "storage.postgres.GetWithdrawals"
 	stmt, err := pg.db.Prepare(`select
-											o.number,
+											w.id,
+											w.number,
 											w.sum,
-											w.processed_at
+											w.processed_at,
+											w.reversal_of,
+											w.reason
 										from withdrawal_accruals w
-										left join orders o on o.id = w.order_id
-										where w.user_id = $1;`)
+										where w.user_id = $1
+										order by w.processed_at, w.id;`)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
@@ -220,17 +339,23 @@ func (pg *StorePostgres) GetWithdrawals(ctx context.Context, userID int64) (mode
 
 	withdrawalsArray := models.WithdrawalsArray{}
 	for rows.Next() {
+		var id int64
 		var number sql.NullInt64
-		var sum sql.NullFloat64
+		var sum models.Money
 		var processed sql.NullInt64
+		var reversalOf sql.NullInt64
+		var reason sql.NullString
 
-		if err := rows.Scan(&number, &sum, &processed); err != nil {
+		if err := rows.Scan(&id, &number, &sum, &processed, &reversalOf, &reason); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		withdrawals := models.Withdrawals{
+			ID:          id,
 			OrderNum:    number.Int64,
-			Sum:         sum.Float64,
+			Sum:         sum,
 			ProcessedAt: processed.Int64,
+			ReversalOf:  reversalOf.Int64,
+			Reason:      reason.String,
 		}
 		withdrawalsArray = append(withdrawalsArray, withdrawals)
 	}
@@ -245,103 +370,1626 @@ func (pg *StorePostgres) GetWithdrawals(ctx context.Context, userID int64) (mode
 	return withdrawalsArray, nil
 }
 
-func (pg *StorePostgres) AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64, processed int64) error {
+func (pg *StorePostgres) AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, processed int64) error {
 	const op = "storage.postgres.AddWithdrawal"
-	stmt, err := pg.db.Prepare(`
-									insert into withdrawal_accruals(order_id, user_id, sum, processed_at)
-									values ($1, $2, $3, $4);`)
-	//values ((select id from orders where number = $1), $2, $3, $4);`)
+
+	if sum <= 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrInvalidWithdrawSum)
+	}
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	var reserved bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT exists(SELECT 1 FROM withdrawal_reservations WHERE number = $1 AND status = 'RESERVED')", numOrder).Scan(&reserved)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if reserved {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+
+	if err := pg.insertWithdrawal(ctx, tx, numOrder, userID, sum, processed); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	_, err = stmt.ExecContext(ctx, numOrder, userID, sum, processed)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
 
+func (pg *StorePostgres) insertWithdrawal(ctx context.Context, tx *sql.Tx, numOrder int64, userID int64, sum models.Money, processed int64) error {
+	_, err := tx.ExecContext(ctx, `
+									insert into withdrawal_accruals(number, user_id, sum, processed_at)
+									values ($1, $2, $3, $4);`, numOrder, userID, sum, processed)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			if pgErr.Message == "there are not enough bonuses to deduct" {
-				return fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+				return models.ErrWithdrawBalanceUser
+			}
+			if pgErr.Code == "23505" {
+				return models.ErrWithdrawalExists
 			}
 		}
-		return fmt.Errorf("%s: %w", op, err)
+		return err
 	}
 
-	return nil
+	return pg.postLedger(ctx, tx, models.LedgerKindWithdrawal, numOrder, "", processed,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: -sum},
+		posting{account: models.LedgerAccountWithdrawal, amount: sum},
+	)
 }
 
-func (pg *StorePostgres) GetOrdersInWork(ctx context.Context) (models.OrderArray, error) {
-	const op = "storage.postgres.GetOrdersInWork"
-	stmt, err := pg.db.Prepare("SELECT number, status, accrual, uploaded_at FROM orders WHERE status not in ('INVALID', 'PROCESSED');")
+func (pg *StorePostgres) ReverseWithdrawal(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string, processed int64) (*models.Withdrawals, error) {
+	const op = "storage.postgres.ReverseWithdrawal"
 
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
 
-	rows, err := stmt.QueryContext(ctx)
+	var id, userID int64
+	var original models.Money
+	err = tx.QueryRowContext(ctx, `
+									select id, user_id, sum
+									from withdrawal_accruals
+									where number = $1 and reversal_of is null
+									for update;`, numOrder).Scan(&id, &userID, &original)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var reversed models.Money
+	err = tx.QueryRowContext(ctx, "SELECT coalesce(-sum(sum), 0) FROM withdrawal_accruals WHERE reversal_of = $1", id).Scan(&reversed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sum, err = models.ReversalSum(original, reversed, sum)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reversal := &models.Withdrawals{
+		OrderNum:    numOrder,
+		Sum:         -sum,
+		ProcessedAt: processed,
+		ReversalOf:  id,
+		ReversedBy:  operator,
+		Reason:      reason,
+	}
+	err = tx.QueryRowContext(ctx, `
+									insert into withdrawal_accruals (number, user_id, sum, processed_at, reversal_of, reversed_by, reason)
+									values ($1, $2, $3, $4, $5, $6, $7)
+									returning id;`,
+		numOrder, userID, reversal.Sum, processed, id, operator, reason).Scan(&reversal.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var spentTx int64
+	err = tx.QueryRowContext(ctx, `
+									select tx_id from ledger_entries
+									where kind = $1 and order_number = $2 and account = $3 and user_id = $4
+									order by id
+									limit 1;`,
+		models.LedgerKindWithdrawal, numOrder, models.LedgerAccountUser, userID).Scan(&spentTx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = pg.postLedger(ctx, tx, models.LedgerKindReversal, numOrder, reason, processed,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: sum, restoreTx: spentTx},
+		posting{account: models.LedgerAccountWithdrawal, amount: -sum},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return reversal, nil
+}
+
+func (pg *StorePostgres) ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, created int64, expires int64) (*models.Reservation, error) {
+	const op = "storage.postgres.ReserveWithdraw"
 
+	if sum <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrInvalidWithdrawSum)
+	}
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	defer func() {
-		if err := rows.Close(); err != nil {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
 			slog.Error(op, "Error", err)
 		}
 	}()
 
-	orderArray := models.OrderArray{}
-	for rows.Next() {
-		var order models.Order
-		var status sql.NullString
-		var accrual sql.NullFloat64
+	available, err := lockBalance(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if available <= sum {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
 
-		if err := rows.Scan(&order.Number, &status, &accrual, &order.UploadedAt); err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
+	var withdrawn bool
+	err = tx.QueryRowContext(ctx, "SELECT exists(SELECT 1 FROM withdrawal_accruals WHERE number = $1)", numOrder).Scan(&withdrawn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if withdrawn {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
+	}
+
+	reservation := &models.Reservation{
+		UserID:    userID,
+		OrderNum:  numOrder,
+		Sum:       sum,
+		Status:    models.ReservationReserved,
+		CreatedAt: created,
+		ExpiresAt: expires,
+	}
+	err = tx.QueryRowContext(ctx, `
+									insert into withdrawal_reservations (user_id, number, sum, status, created_at, expires_at)
+									values ($1, $2, $3, $4, $5, $6)
+									returning id;`, userID, numOrder, sum, reservation.Status, created, expires).Scan(&reservation.ID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawalExists)
 		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-		order.Status = status.String
-		order.Accrual = accrual.Float64
-		orderArray = append(orderArray, order)
+	if _, err := tx.ExecContext(ctx, "UPDATE user_balances SET reserved = reserved + $2 WHERE user_id = $1", userID, sum); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if rows.Err() != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	return reservation, nil
+}
 
-	if len(orderArray) == 0 {
-		return nil, fmt.Errorf("%s: %w", op, models.ErrOrdersInWorkIsEmpty)
+func (pg *StorePostgres) ConfirmReservation(ctx context.Context, numOrder int64, userID int64, now int64) error {
+	const op = "storage.postgres.ConfirmReservation"
+	return pg.resolveReservation(ctx, op, numOrder, userID, now, models.ReservationConfirmed)
+}
+
+func (pg *StorePostgres) CancelReservation(ctx context.Context, numOrder int64, userID int64, now int64) error {
+	const op = "storage.postgres.CancelReservation"
+	return pg.resolveReservation(ctx, op, numOrder, userID, now, models.ReservationCancelled)
+}
+
+func (pg *StorePostgres) resolveReservation(ctx context.Context, op string, numOrder int64, userID int64, now int64, status string) error {
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	return orderArray, nil
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	if _, err := lockBalance(ctx, tx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id, expires int64
+	var sum models.Money
+	var current string
+	err = tx.QueryRowContext(ctx, `
+									select id, sum, status, expires_at
+									from withdrawal_reservations
+									where number = $1 and user_id = $2
+									for update;`, numOrder, userID).Scan(&id, &sum, &current, &expires)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, models.ErrReservationNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := models.CanResolveReservation(current, status, expires, now); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE withdrawal_reservations SET status = $2, resolved_at = $3 WHERE id = $1", id, status, now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE user_balances SET reserved = reserved - $2 WHERE user_id = $1", userID, sum); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if status == models.ReservationConfirmed {
+		if err := pg.insertWithdrawal(ctx, tx, numOrder, userID, sum, now); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
 }
 
-func (pg *StorePostgres) UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) error {
-	const op = "storage.postgres.UpdateOrdersBatch"
+func (pg *StorePostgres) ExpireReservations(ctx context.Context, now int64) (int64, error) {
+	const op = "storage.postgres.ExpireReservations"
+	stmt, err := pg.db.Prepare(`
+									with expired as (update withdrawal_reservations
+									                 set status = 'EXPIRED', resolved_at = $1
+									                 where status = 'RESERVED' and expires_at <= $1
+									                 returning user_id, sum),
+									     per_user as (select user_id, sum(sum) as total, count(*) as expired
+									                  from expired
+									                  group by user_id),
+									     released as (update user_balances b
+									                  set reserved = b.reserved - p.total
+									                  from per_user p
+									                  where b.user_id = p.user_id
+									                  returning p.expired)
+									select coalesce(sum(expired), 0) from released;`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
 
-	values := make([]string, len(orders))
-	args := make([]interface{}, 0, len(orders)*3)
-	for i, order := range orders {
-		pos1, pos2, pos3 := len(args)+1, len(args)+2, len(args)+3
-		values[i] = fmt.Sprintf("($%d::bigint, $%d::text, $%d::float8)", pos1, pos2, pos3)
-		args = append(args, order.OrderNum, order.Status, order.Accrual)
+	var expired int64
+	if err := stmt.QueryRowContext(ctx, now).Scan(&expired); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
+	return expired, nil
+}
 
-	query := fmt.Sprintf(`
-        UPDATE orders o
-        SET status = v.status,
-            accrual = v.accrual
-        FROM (VALUES %s) AS v(number, status, accrual)
-        WHERE o.number = v.number
-    `, strings.Join(values, ", "))
+func (pg *StorePostgres) AddAdjustment(ctx context.Context, userID int64, amount models.Money, description string, created int64) error {
+	const op = "storage.postgres.AddAdjustment"
 
-	stmt, err := pg.db.Prepare(query)
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	available, err := lockBalance(ctx, tx, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if amount < 0 && available+amount < 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
 
-	_, err = stmt.ExecContext(ctx, args...)
+	err = pg.postLedger(ctx, tx, models.LedgerKindAdjustment, 0, description, created,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: amount},
+		posting{account: models.LedgerAccountAdjustment, amount: -amount},
+	)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	return nil
 }
+
+func (pg *StorePostgres) GetStatement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error) {
+	const op = "storage.postgres.GetStatement"
+	stmt, err := pg.db.Prepare(`select
+											id,
+											tx_id,
+											kind,
+											amount,
+											order_number,
+											description,
+											created_at
+										from ledger_entries
+										where account = 'user' and user_id = $1
+										order by id desc
+										limit $2 offset $3;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	entries := models.LedgerEntryArray{}
+	for rows.Next() {
+		entry := models.LedgerEntry{UserID: userID, Account: models.LedgerAccountUser}
+		var number sql.NullInt64
+		var description sql.NullString
+
+		if err := rows.Scan(&entry.ID, &entry.TxID, &entry.Kind, &entry.Amount, &number, &description, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entry.OrderNum = number.Int64
+		entry.Description = description.String
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrStatementEmpty)
+	}
+	return entries, nil
+}
+
+func (pg *StorePostgres) CheckBalances(ctx context.Context) (models.BalanceDriftArray, error) {
+	const op = "storage.postgres.CheckBalances"
+	stmt, err := pg.db.Prepare(`
+									with expected as (select
+									                      l.user_id,
+									                      sum(l.amount) as current,
+									                      -sum(case when l.kind in ('WITHDRAWAL', 'REVERSAL') then l.amount else 0 end) as withdrawn
+									                  from ledger_entries l
+									                  where l.account = 'user'
+									                  group by l.user_id),
+									     held as (select
+									                  r.user_id,
+									                  sum(r.sum) as reserved
+									              from withdrawal_reservations r
+									              where r.status = 'RESERVED'
+									              group by r.user_id),
+									     users as (select user_id from user_balances
+									               union
+									               select user_id from expected
+									               union
+									               select user_id from held)
+									select
+									    u.user_id,
+									    coalesce(b.current, 0),
+									    coalesce(e.current, 0),
+									    coalesce(b.withdrawn, 0),
+									    coalesce(e.withdrawn, 0),
+									    coalesce(b.reserved, 0),
+									    coalesce(h.reserved, 0)
+									from users u
+									left join user_balances b on b.user_id = u.user_id
+									left join expected e on e.user_id = u.user_id
+									left join held h on h.user_id = u.user_id
+									where coalesce(b.current, 0) <> coalesce(e.current, 0)
+									   or coalesce(b.withdrawn, 0) <> coalesce(e.withdrawn, 0)
+									   or coalesce(b.reserved, 0) <> coalesce(h.reserved, 0)
+									order by 1;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	drifts := models.BalanceDriftArray{}
+	for rows.Next() {
+		var drift models.BalanceDrift
+		if err := rows.Scan(&drift.UserID, &drift.Current, &drift.ExpectedCurrent, &drift.Withdrawn, &drift.ExpectedWithdrawn,
+			&drift.Reserved, &drift.ExpectedReserved); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		drifts = append(drifts, drift)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return drifts, nil
+}
+
+func lockBalance(ctx context.Context, tx *sql.Tx, userID int64) (models.Money, error) {
+	_, err := tx.ExecContext(ctx, "INSERT INTO user_balances (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING", userID)
+	if err != nil {
+		return 0, err
+	}
+	var available models.Money
+	if err := tx.QueryRowContext(ctx, "SELECT current - reserved FROM user_balances WHERE user_id = $1 FOR UPDATE", userID).Scan(&available); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
+
+// posting is one leg of a ledger transaction. A user credit normally earns a
+// fresh lot; with carry it takes over the lots spent by the debits posted
+// before it in the same transaction, and with restoreTx it puts back the lots
+// that transaction spent.
+type posting struct {
+	account   string
+	userID    int64
+	amount    models.Money
+	carry     bool
+	restoreTx int64
+}
+
+func (pg *StorePostgres) postLedger(ctx context.Context, tx *sql.Tx, kind string, numOrder int64, description string, created int64, postings ...posting) error {
+	var txID int64
+	if err := tx.QueryRowContext(ctx, "SELECT nextval('ledger_tx_seq')").Scan(&txID); err != nil {
+		return err
+	}
+
+	number := sql.NullInt64{Int64: numOrder, Valid: numOrder != 0}
+	desc := sql.NullString{String: description, Valid: description != ""}
+	for _, p := range postings {
+		userID := sql.NullInt64{Int64: p.userID, Valid: p.userID != 0}
+		_, err := tx.ExecContext(ctx, `
+									insert into ledger_entries (tx_id, account, user_id, kind, amount, order_number, description, created_at)
+									values ($1, $2, $3, $4, $5, $6, $7, $8);`,
+			txID, p.account, userID, kind, p.amount, number, desc, created)
+		if err != nil {
+			return err
+		}
+		if p.account != models.LedgerAccountUser {
+			continue
+		}
+
+		var withdrawn models.Money
+		if kind == models.LedgerKindWithdrawal || kind == models.LedgerKindReversal {
+			withdrawn = -p.amount
+		}
+		_, err = tx.ExecContext(ctx, `
+									insert into user_balances (user_id, current, withdrawn, updated_at)
+									values ($1, $2, $3, $4)
+									on conflict (user_id) do update
+									set current = user_balances.current + excluded.current,
+									    withdrawn = user_balances.withdrawn + excluded.withdrawn,
+									    updated_at = excluded.updated_at;`,
+			p.userID, p.amount, withdrawn, created)
+		if err != nil {
+			return err
+		}
+
+		if p.amount > 0 {
+			err = pg.creditLots(ctx, tx, txID, kind, number, created, p)
+		} else {
+			err = consumeLots(ctx, tx, txID, p.userID, -p.amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// creditLots records a user credit as point lots: carried over from the lots
+// the same transaction spent, restored into the lots restoreTx spent, or,
+// for whatever is left, a fresh lot expiring after the configured lifetime.
+func (pg *StorePostgres) creditLots(ctx context.Context, tx *sql.Tx, txID int64, kind string, number sql.NullInt64, created int64, p posting) error {
+	left := p.amount
+	switch {
+	case p.carry:
+		rows, err := tx.QueryContext(ctx, `
+									select s.amount, l.earned_at, l.expires_at
+									from point_lot_spends s
+									join point_lots l on l.id = s.lot_id
+									where s.tx_id = $1
+									order by s.id;`, txID)
+		if err != nil {
+			return err
+		}
+		type carried struct {
+			amount  models.Money
+			earned  int64
+			expires sql.NullInt64
+		}
+		lots := make([]carried, 0)
+		for rows.Next() {
+			var lot carried
+			if err := rows.Scan(&lot.amount, &lot.earned, &lot.expires); err != nil {
+				rows.Close()
+				return err
+			}
+			lots = append(lots, lot)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			if left <= 0 {
+				break
+			}
+			amount := min(lot.amount, left)
+			if err := insertLot(ctx, tx, p.userID, kind, number, amount, lot.earned, lot.expires); err != nil {
+				return err
+			}
+			left -= amount
+		}
+	case p.restoreTx != 0:
+		rows, err := tx.QueryContext(ctx, `
+									select s.id, s.lot_id, s.amount - s.restored
+									from point_lot_spends s
+									join point_lots l on l.id = s.lot_id
+									where s.tx_id = $1 and s.restored < s.amount
+									order by l.expires_at desc nulls first, l.id desc
+									for update of s, l;`, p.restoreTx)
+		if err != nil {
+			return err
+		}
+		type spend struct {
+			id, lotID int64
+			amount    models.Money
+		}
+		spends := make([]spend, 0)
+		for rows.Next() {
+			var s spend
+			if err := rows.Scan(&s.id, &s.lotID, &s.amount); err != nil {
+				rows.Close()
+				return err
+			}
+			spends = append(spends, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, s := range spends {
+			if left <= 0 {
+				break
+			}
+			amount := min(s.amount, left)
+			if _, err := tx.ExecContext(ctx, "UPDATE point_lot_spends SET restored = restored + $2 WHERE id = $1", s.id, amount); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE point_lots SET remaining = remaining + $2 WHERE id = $1", s.lotID, amount); err != nil {
+				return err
+			}
+			left -= amount
+		}
+	}
+	if left <= 0 {
+		return nil
+	}
+	expires := sql.NullInt64{Int64: models.PointsExpireAt(created, pg.pointsLifetime)}
+	expires.Valid = expires.Int64 != 0
+	return insertLot(ctx, tx, p.userID, kind, number, left, created, expires)
+}
+
+func insertLot(ctx context.Context, tx *sql.Tx, userID int64, kind string, number sql.NullInt64, amount models.Money, earned int64, expires sql.NullInt64) error {
+	_, err := tx.ExecContext(ctx, `
+									insert into point_lots (user_id, source, order_number, amount, remaining, earned_at, expires_at)
+									values ($1, $2, $3, $4, $4, $5, $6);`,
+		userID, kind, number, amount, earned, expires)
+	return err
+}
+
+func consumeLots(ctx context.Context, tx *sql.Tx, txID int64, userID int64, amount models.Money) error {
+	rows, err := tx.QueryContext(ctx, `
+									select id, remaining from point_lots
+									where user_id = $1 and remaining > 0
+									order by expires_at nulls last, id
+									for update;`, userID)
+	if err != nil {
+		return err
+	}
+	lots := make([]models.PointLot, 0)
+	for rows.Next() {
+		var lot models.PointLot
+		if err := rows.Scan(&lot.ID, &lot.Remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		take := min(lot.Remaining, amount)
+		if _, err := tx.ExecContext(ctx, "UPDATE point_lots SET remaining = remaining - $2 WHERE id = $1", lot.ID, take); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO point_lot_spends (tx_id, lot_id, amount) VALUES ($1, $2, $3)", txID, lot.ID, take)
+		if err != nil {
+			return err
+		}
+		amount -= take
+	}
+	return nil
+}
+
+func (pg *StorePostgres) GetExpiringPoints(ctx context.Context, userID int64, before int64) (models.ExpiringPointsArray, error) {
+	const op = "storage.postgres.GetExpiringPoints"
+
+	rows, err := pg.db.QueryContext(ctx, `
+									select expires_at - expires_at % 86400 as day, sum(remaining)
+									from point_lots
+									where user_id = $1 and remaining > 0 and expires_at <= $2
+									group by day
+									order by day;`, userID, before)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	expiring := models.ExpiringPointsArray{}
+	for rows.Next() {
+		var points models.ExpiringPoints
+		if err := rows.Scan(&points.Date, &points.Amount); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		expiring = append(expiring, points)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return expiring, nil
+}
+
+func (pg *StorePostgres) ExpirePoints(ctx context.Context, now int64) (models.Money, error) {
+	const op = "storage.postgres.ExpirePoints"
+
+	rows, err := pg.db.QueryContext(ctx, `
+									select distinct user_id from point_lots
+									where remaining > 0 and expires_at <= $1
+									order by user_id;`, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	userIDs := make([]int64, 0)
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var total models.Money
+	for _, userID := range userIDs {
+		expired, err := pg.expireUserPoints(ctx, userID, now)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", op, err)
+		}
+		total += expired
+	}
+	return total, nil
+}
+
+func (pg *StorePostgres) expireUserPoints(ctx context.Context, userID int64, now int64) (models.Money, error) {
+	const op = "storage.postgres.expireUserPoints"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	available, err := lockBalance(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var expired models.Money
+	err = tx.QueryRowContext(ctx, `
+									select coalesce(sum(remaining), 0) from point_lots
+									where user_id = $1 and remaining > 0 and expires_at <= $2;`, userID, now).Scan(&expired)
+	if err != nil {
+		return 0, err
+	}
+
+	amount := min(expired, available)
+	if amount <= 0 {
+		return 0, nil
+	}
+	err = pg.postLedger(ctx, tx, models.LedgerKindExpiration, 0, "", now,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: -amount},
+		posting{account: models.LedgerAccountExpiration, amount: amount},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+func (pg *StorePostgres) ClaimOrdersInWork(ctx context.Context, owner string, limit int, lease time.Duration, filter models.ClaimFilter) (models.OrderArray, error) {
+	const op = "storage.postgres.ClaimOrdersInWork"
+	args := []interface{}{time.Now().Unix(), int64(lease.Seconds()), owner, limit}
+	skip, args := claimFilterSQL(filter, args)
+	// The filter makes the query text vary per call, so it is not worth preparing.
+	rows, err := pg.db.QueryContext(ctx, fmt.Sprintf(`
+									update orders o
+									set locked_until = $1 + $2,
+									    locked_by = $3
+									from (select id
+									      from orders
+									      where status not in ('INVALID', 'PROCESSED', 'UNKNOWN')
+									        and dead_lettered_at is null
+									        and next_poll_at <= $1
+									        and (locked_until is null or locked_until <= $1)
+									        %s
+									      order by next_poll_at, id
+									      limit $4
+									      for update skip locked) c
+									where o.id = c.id
+									returning o.number, o.status, o.accrual, o.uploaded_at, o.user_id, o.attempts;`, skip), args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	orderArray := models.OrderArray{}
+	for rows.Next() {
+		var order models.Order
+		var status sql.NullString
+
+		if err := rows.Scan(&order.Number, &status, &order.Accrual, &order.UploadedAt, &order.UserID, &order.Attempts); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		order.Status = status.String
+		orderArray = append(orderArray, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(orderArray) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrOrdersInWorkIsEmpty)
+	}
+	return orderArray, nil
+}
+
+func claimFilterSQL(filter models.ClaimFilter, args []interface{}) (string, []interface{}) {
+	if filter.SkipsNone() {
+		return "", args
+	}
+	if len(filter.Routes) == 0 {
+		return "and false", args
+	}
+	var b strings.Builder
+	b.WriteString("and not case")
+	for _, route := range filter.Routes {
+		conds := []string{"true"}
+		if route.Prefix != "" {
+			args = append(args, route.Prefix)
+			conds = append(conds, fmt.Sprintf("starts_with(number::text, $%d::text)", len(args)))
+		}
+		if len(route.UserIDs) > 0 {
+			args = append(args, route.UserIDs)
+			conds = append(conds, fmt.Sprintf("user_id = any($%d::bigint[])", len(args)))
+		}
+		fmt.Fprintf(&b, " when %s then %t", strings.Join(conds, " and "), route.Skip)
+	}
+	fmt.Fprintf(&b, " else %t end", filter.SkipDefault)
+	return b.String(), args
+}
+
+func (pg *StorePostgres) RescheduleOrder(ctx context.Context, numOrder int64, owner string, attempts int, nextPollAt int64) error {
+	const op = "storage.postgres.RescheduleOrder"
+	stmt, err := pg.db.Prepare(`
+									update orders
+									set attempts = $3,
+									    next_poll_at = $4,
+									    locked_until = null,
+									    locked_by = null
+									where number = $1
+									  and locked_by = $2;`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, numOrder, owner, attempts, nextPollAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) RecordOrderFailure(ctx context.Context, numOrder int64, owner string, lastErr string, maxFailures int, nextPollAt int64) (bool, error) {
+	const op = "storage.postgres.RecordOrderFailure"
+	stmt, err := pg.db.Prepare(`
+									update orders
+									set failures = failures + 1,
+									    attempts = attempts + 1,
+									    last_error = $3,
+									    next_poll_at = $5,
+									    locked_until = null,
+									    locked_by = null,
+									    dead_lettered_at = case when failures + 1 >= $4 then $6 else null end
+									where number = $1
+									  and locked_by = $2
+									returning dead_lettered_at is not null;`)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var deadLettered bool
+	err = stmt.QueryRowContext(ctx, numOrder, owner, lastErr, maxFailures, nextPollAt, time.Now().Unix()).Scan(&deadLettered)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return deadLettered, nil
+}
+
+func (pg *StorePostgres) GetDeadLetterOrders(ctx context.Context) (models.DeadLetterOrderArray, error) {
+	const op = "storage.postgres.GetDeadLetterOrders"
+	stmt, err := pg.db.Prepare(`
+									select number, user_id, status, attempts, failures, last_error, uploaded_at, dead_lettered_at
+									from orders
+									where dead_lettered_at is not null
+									order by dead_lettered_at;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	orders := models.DeadLetterOrderArray{}
+	for rows.Next() {
+		order, err := scanDeadLetterOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		orders = append(orders, *order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrDeadLetterEmpty)
+	}
+	return orders, nil
+}
+
+func (pg *StorePostgres) GetDeadLetterOrder(ctx context.Context, numOrder int64) (*models.DeadLetterOrder, error) {
+	const op = "storage.postgres.GetDeadLetterOrder"
+	stmt, err := pg.db.Prepare(`
+									select number, user_id, status, attempts, failures, last_error, uploaded_at, dead_lettered_at
+									from orders
+									where number = $1
+									  and dead_lettered_at is not null;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	order, err := scanDeadLetterOrder(stmt.QueryRowContext(ctx, numOrder))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrDeadLetterNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return order, nil
+}
+
+func (pg *StorePostgres) RequeueDeadLetterOrder(ctx context.Context, numOrder int64) error {
+	const op = "storage.postgres.RequeueDeadLetterOrder"
+	stmt, err := pg.db.Prepare(`
+									update orders
+									set dead_lettered_at = null,
+									    failures = 0,
+									    attempts = 0,
+									    next_poll_at = 0
+									where number = $1
+									  and dead_lettered_at is not null;`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, numOrder)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrDeadLetterNotFound)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeadLetterOrder(row rowScanner) (*models.DeadLetterOrder, error) {
+	var order models.DeadLetterOrder
+	var status, lastError sql.NullString
+	if err := row.Scan(&order.Number, &order.UserID, &status, &order.Attempts, &order.Failures,
+		&lastError, &order.UploadedAt, &order.DeadLetteredAt); err != nil {
+		return nil, err
+	}
+	order.Status = status.String
+	order.LastError = lastError.String
+	return &order, nil
+}
+
+func (pg *StorePostgres) UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) (models.ProcessedOrderArray, error) {
+	const op = "storage.postgres.UpdateOrdersBatch"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	numbers := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		numbers = append(numbers, order.OrderNum)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT number, status, user_id FROM orders WHERE number = any($1) FOR UPDATE", numbers)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	current := make(map[int64]string, len(orders))
+	owners := make(map[int64]int64, len(orders))
+	for rows.Next() {
+		var number, userID int64
+		var status sql.NullString
+		if err := rows.Scan(&number, &status, &userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		current[number] = status.String
+		owners[number] = userID
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	rows.Close()
+
+	latest := make(map[int64]*models.ResAccrualOrder, len(orders))
+	updated := make([]int64, 0, len(orders))
+	credited := make(models.ResAccrualOrderArray, 0, len(orders))
+	processed := models.ProcessedOrderArray{}
+	for _, order := range orders {
+		from, ok := current[order.OrderNum]
+		if !ok {
+			continue
+		}
+		if !models.CanTransition(from, order.Status) {
+			slog.Warn(op,
+				"number", order.OrderNum,
+				"from", from,
+				"to", order.Status,
+				"error", models.ErrIllegalTransition,
+			)
+			continue
+		}
+		if _, ok := latest[order.OrderNum]; !ok {
+			updated = append(updated, order.OrderNum)
+		}
+		latest[order.OrderNum] = order
+		current[order.OrderNum] = order.Status
+		if order.Status != models.StatusProcessed {
+			continue
+		}
+		processed = append(processed, models.ProcessedOrder{OrderNum: order.OrderNum, UserID: owners[order.OrderNum], Accrual: order.Accrual})
+		if order.Accrual > 0 {
+			credited = append(credited, order)
+		}
+	}
+
+	if len(updated) == 0 {
+		return processed, tx.Commit()
+	}
+
+	now := time.Now().Unix()
+	if err := positionProcessed(ctx, tx, processed, now); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	values := make([]string, 0, len(updated))
+	args := []interface{}{now}
+	for _, number := range updated {
+		order := latest[number]
+		pos1, pos2, pos3 := len(args)+1, len(args)+2, len(args)+3
+		values = append(values, fmt.Sprintf("($%d::bigint, $%d::text, $%d::numeric)", pos1, pos2, pos3))
+		args = append(args, order.OrderNum, order.Status, order.Accrual)
+	}
+
+	query := fmt.Sprintf(`
+        UPDATE orders o
+        SET status = v.status,
+            accrual = v.accrual,
+            processed_at = case when v.status = 'PROCESSED' then $1::bigint else o.processed_at end
+        FROM (VALUES %s) AS v(number, status, accrual)
+        WHERE o.number = v.number
+    `, strings.Join(values, ", "))
+
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, order := range processed {
+		_, err := tx.ExecContext(ctx, `
+									insert into processed_order_events (order_number, user_id, accrual, processed_at, position, lifetime_accrual, next_attempt_at)
+									values ($1, $2, $3, $4, $5, $6, $4);`,
+			order.OrderNum, order.UserID, order.Accrual, order.ProcessedAt, order.Position, order.LifetimeAccrual)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	sort.SliceStable(credited, func(i, j int) bool {
+		return owners[credited[i].OrderNum] < owners[credited[j].OrderNum]
+	})
+	for _, order := range credited {
+		err := pg.postLedger(ctx, tx, models.LedgerKindAccrual, order.OrderNum, "", now,
+			posting{account: models.LedgerAccountUser, userID: owners[order.OrderNum], amount: order.Accrual},
+			posting{account: models.LedgerAccountAccrual, amount: -order.Accrual},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return processed, nil
+}
+
+// positionProcessed stamps orders with the time they were processed, their
+// place among their owner's processed orders and the owner's lifetime accrual. The owners' balances stay locked
+// until commit, so concurrent batches for the same user count one another.
+func positionProcessed(ctx context.Context, tx *sql.Tx, orders models.ProcessedOrderArray, now int64) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	userIDs := make([]int64, 0, len(orders))
+	seen := make(map[int64]struct{}, len(orders))
+	for _, order := range orders {
+		if _, ok := seen[order.UserID]; !ok {
+			seen[order.UserID] = struct{}{}
+			userIDs = append(userIDs, order.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	for _, userID := range userIDs {
+		if _, err := lockBalance(ctx, tx, userID); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+									select user_id, count(*), coalesce(sum(accrual), 0) from orders
+									where user_id = any($1) and status = 'PROCESSED'
+									group by user_id;`, userIDs)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int64]int, len(userIDs))
+	lifetimes := make(map[int64]models.Money, len(userIDs))
+	for rows.Next() {
+		var userID int64
+		var count int
+		var lifetime models.Money
+		if err := rows.Scan(&userID, &count, &lifetime); err != nil {
+			rows.Close()
+			return err
+		}
+		counts[userID] = count
+		lifetimes[userID] = lifetime
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range orders {
+		counts[orders[i].UserID]++
+		lifetimes[orders[i].UserID] += orders[i].Accrual
+		orders[i].ProcessedAt = now
+		orders[i].Position = counts[orders[i].UserID]
+		orders[i].LifetimeAccrual = lifetimes[orders[i].UserID]
+	}
+	return nil
+}
+
+func (pg *StorePostgres) ClaimProcessedOrders(ctx context.Context, limit int, now int64, lease time.Duration) (models.ProcessedOrderArray, error) {
+	const op = "storage.postgres.ClaimProcessedOrders"
+
+	rows, err := pg.db.QueryContext(ctx, `
+									update processed_order_events e
+									set next_attempt_at = $1 + $2
+									from (select order_number
+									      from processed_order_events
+									      where next_attempt_at <= $1
+									      order by processed_at, position, order_number
+									      limit $3
+									      for update skip locked) c
+									where e.order_number = c.order_number
+									returning e.order_number, e.user_id, e.accrual, e.processed_at, e.position, e.lifetime_accrual, e.attempts;`,
+		now, int64(lease.Seconds()), limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	orders := models.ProcessedOrderArray{}
+	for rows.Next() {
+		var order models.ProcessedOrder
+		if err := rows.Scan(&order.OrderNum, &order.UserID, &order.Accrual, &order.ProcessedAt, &order.Position, &order.LifetimeAccrual, &order.Attempts); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].ProcessedAt < orders[j].ProcessedAt ||
+			(orders[i].ProcessedAt == orders[j].ProcessedAt && orders[i].Position < orders[j].Position)
+	})
+	return orders, nil
+}
+
+func (pg *StorePostgres) AckProcessedOrder(ctx context.Context, numOrder int64) error {
+	const op = "storage.postgres.AckProcessedOrder"
+
+	if _, err := pg.db.ExecContext(ctx, "DELETE FROM processed_order_events WHERE order_number = $1", numOrder); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) RetryProcessedOrder(ctx context.Context, numOrder int64, lastErr string, nextAttemptAt int64) error {
+	const op = "storage.postgres.RetryProcessedOrder"
+
+	_, err := pg.db.ExecContext(ctx, `
+									update processed_order_events
+									set attempts = attempts + 1,
+									    last_error = $2,
+									    next_attempt_at = $3
+									where order_number = $1;`, numOrder, lastErr, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) GetLifetimeAccrual(ctx context.Context, userID int64) (models.Money, error) {
+	const op = "storage.postgres.GetLifetimeAccrual"
+
+	var lifetime models.Money
+	err := pg.db.QueryRowContext(ctx,
+		"SELECT coalesce(sum(accrual), 0) FROM orders WHERE user_id = $1 AND status = 'PROCESSED'", userID).Scan(&lifetime)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return lifetime, nil
+}
+
+func (pg *StorePostgres) AddOrderBonus(ctx context.Context, numOrder int64, userID int64, bonuses models.OrderBonusArray, created int64) error {
+	const op = "storage.postgres.AddOrderBonus"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	var applied sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT bonus::text FROM orders WHERE number = $1 AND user_id = $2 FOR UPDATE", numOrder, userID).Scan(&applied)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, models.ErrOrderNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if applied.Valid {
+		return fmt.Errorf("%s: %w", op, models.ErrBonusApplied)
+	}
+
+	names := make([]string, 0, len(bonuses))
+	for _, bonus := range bonuses {
+		_, err := tx.ExecContext(ctx, `
+									insert into order_bonuses (order_number, campaign, amount, created_at)
+									values ($1, $2, $3, $4);`, numOrder, bonus.Campaign, bonus.Amount, created)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		names = append(names, bonus.Campaign)
+	}
+	total := bonuses.Total()
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET bonus = $2 WHERE number = $1", numOrder, total); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = pg.postLedger(ctx, tx, models.LedgerKindBonus, numOrder, strings.Join(names, ", "), created,
+		posting{account: models.LedgerAccountUser, userID: userID, amount: total},
+		posting{account: models.LedgerAccountCampaign, amount: -total},
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) AddTransfer(ctx context.Context, fromUserID int64, toUserID int64, sum models.Money, limit models.TransferLimit, since int64, created int64) (*models.Transfer, error) {
+	const op = "storage.postgres.AddTransfer"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	locked := map[int64]models.Money{}
+	for _, userID := range []int64{min(fromUserID, toUserID), max(fromUserID, toUserID)} {
+		available, err := lockBalance(ctx, tx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		locked[userID] = available
+	}
+	if locked[fromUserID] <= sum {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrWithdrawBalanceUser)
+	}
+
+	var count int
+	var total models.Money
+	err = tx.QueryRowContext(ctx, `
+									select count(*), coalesce(sum(sum), 0) from transfers
+									where from_user_id = $1 and created_at >= $2;`, fromUserID, since).Scan(&count, &total)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !limit.Allows(count, total, sum) {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTransferLimit)
+	}
+
+	transfer := models.Transfer{FromUserID: fromUserID, ToUserID: toUserID, Sum: sum, CreatedAt: created}
+	err = tx.QueryRowContext(ctx, `
+									insert into transfers (from_user_id, to_user_id, sum, created_at)
+									values ($1, $2, $3, $4)
+									returning id,
+									    (select login from users where id = $1),
+									    (select login from users where id = $2);`,
+		fromUserID, toUserID, sum, created).Scan(&transfer.ID, &transfer.FromLogin, &transfer.ToLogin)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = pg.postLedger(ctx, tx, models.LedgerKindTransfer, 0, transferDescription(transfer), created,
+		posting{account: models.LedgerAccountUser, userID: fromUserID, amount: -sum},
+		posting{account: models.LedgerAccountUser, userID: toUserID, amount: sum, carry: true},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &transfer, nil
+}
+
+func transferDescription(t models.Transfer) string {
+	return fmt.Sprintf("transfer #%d from %s to %s", t.ID, t.FromLogin, t.ToLogin)
+}
+
+func (pg *StorePostgres) GetTransfers(ctx context.Context, userID int64) (models.TransferArray, error) {
+	const op = "storage.postgres.GetTransfers"
+
+	rows, err := pg.db.QueryContext(ctx, `
+									select t.id, t.from_user_id, f.login, t.to_user_id, r.login, t.sum, t.created_at
+									from transfers t
+									join users f on f.id = t.from_user_id
+									join users r on r.id = t.to_user_id
+									where t.from_user_id = $1 or t.to_user_id = $1
+									order by t.created_at desc, t.id desc;`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	transfers := models.TransferArray{}
+	for rows.Next() {
+		var t models.Transfer
+		if err := rows.Scan(&t.ID, &t.FromUserID, &t.FromLogin, &t.ToUserID, &t.ToLogin, &t.Sum, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(transfers) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTransfersEmpty)
+	}
+	return transfers, nil
+}
+
+func (pg *StorePostgres) SetUserTier(ctx context.Context, userID int64, tier string, changedAt int64) (string, error) {
+	const op = "storage.postgres.SetUserTier"
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error(op, "Error", err)
+		}
+	}()
+
+	var previous string
+	err = tx.QueryRowContext(ctx, "SELECT tier FROM user_tiers WHERE user_id = $1 FOR UPDATE", userID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if previous != tier {
+		_, err = tx.ExecContext(ctx, `
+									insert into user_tiers (user_id, tier, updated_at)
+									values ($1, $2, $3)
+									on conflict (user_id) do update
+									set tier = excluded.tier,
+									    updated_at = excluded.updated_at;`, userID, tier, changedAt)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return previous, nil
+}
+
+func (pg *StorePostgres) MarkOrderNotRegistered(ctx context.Context, numOrder int64, seenAt int64, grace time.Duration) error {
+	const op = "storage.postgres.MarkOrderNotRegistered"
+	stmt, err := pg.db.Prepare(`
+									update orders
+									set not_registered_count = not_registered_count + 1,
+									    not_registered_at = $2,
+									    status = case when $2 - uploaded_at >= $3 then 'UNKNOWN' else status end
+									where number = $1
+									  and status not in ('INVALID', 'PROCESSED', 'UNKNOWN');`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, numOrder, seenAt, int64(grace.Seconds()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (pg *StorePostgres) ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, expiredBefore int64) (*models.IdempotencyRecord, error) {
+	const op = "storage.postgres.ReserveIdempotencyKey"
+	stmt, err := pg.db.Prepare(`
+									insert into idempotency_keys (user_id, key, method, path, fingerprint, created_at)
+									values ($1, $2, $3, $4, $5, $6)
+									on conflict (user_id, key) do update
+									set method = excluded.method,
+									    path = excluded.path,
+									    fingerprint = excluded.fingerprint,
+									    status = null,
+									    content_type = null,
+									    body = null,
+									    created_at = excluded.created_at
+									where idempotency_keys.created_at < $7
+									returning created_at;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var created int64
+	err = stmt.QueryRowContext(ctx, record.UserID, record.Key, record.Method, record.Path,
+		record.Fingerprint, record.CreatedAt, expiredBefore).Scan(&created)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	existing := models.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = pg.db.QueryRowContext(ctx, `
+									select method, path, fingerprint, status, content_type, body, created_at
+									from idempotency_keys
+									where user_id = $1 and key = $2;`, record.UserID, record.Key).
+		Scan(&existing.Method, &existing.Path, &existing.Fingerprint, &status, &contentType, &existing.Body, &existing.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	existing.Status = int(status.Int64)
+	existing.ContentType = contentType.String
+	return &existing, nil
+}
+
+func (pg *StorePostgres) CompleteIdempotencyKey(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error {
+	const op = "storage.postgres.CompleteIdempotencyKey"
+	stmt, err := pg.db.Prepare(`
+									update idempotency_keys
+									set status = $3, content_type = $4, body = $5
+									where user_id = $1 and key = $2;`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, key, status, contentType, body); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error {
+	const op = "storage.postgres.ReleaseIdempotencyKey"
+	stmt, err := pg.db.Prepare("DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status IS NULL")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (pg *StorePostgres) PurgeIdempotencyKeys(ctx context.Context, before int64) (int64, error) {
+	const op = "storage.postgres.PurgeIdempotencyKeys"
+	stmt, err := pg.db.Prepare("DELETE FROM idempotency_keys WHERE created_at < $1")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return purged, nil
+}
+
+func (pg *StorePostgres) RememberCallbackSignature(ctx context.Context, signature string, expiresAt int64) (bool, error) {
+	const op = "storage.postgres.RememberCallbackSignature"
+	res, err := pg.db.ExecContext(ctx, `
+									insert into accrual_callback_signatures (signature, expires_at)
+									values ($1, $2)
+									on conflict (signature) do nothing;`, signature, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return inserted == 1, nil
+}
+
+func (pg *StorePostgres) PurgeCallbackSignatures(ctx context.Context, before int64) (int64, error) {
+	const op = "storage.postgres.PurgeCallbackSignatures"
+	res, err := pg.db.ExecContext(ctx, "DELETE FROM accrual_callback_signatures WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return purged, nil
+}
@@ -3,30 +3,70 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ArtShib/gophermart.git/internal/models"
+	"github.com/ArtShib/gophermart.git/internal/storage/memory"
 	"github.com/ArtShib/gophermart.git/internal/storage/postgres"
 )
 
 type Storage interface {
 	Close() error
-	SaveUser(ctx context.Context, login string, passHash []byte) (*models.User, error)
+	SaveUser(ctx context.Context, login string, passHash []byte, referralCode string, referredBy int64) (*models.User, error)
 	User(ctx context.Context, login string) (*models.User, error)
 	AddOrder(ctx context.Context, numOrder int64, uploaded int64, userID int64) error
 	GetOrder(ctx context.Context, userID int64) (models.OrderArray, error)
 	GetBalance(ctx context.Context, userID int64) (*models.Balance, error)
 	GetWithdrawals(ctx context.Context, userID int64) (models.WithdrawalsArray, error)
-	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum float64, processed int64) error
-	GetOrdersInWork(ctx context.Context) (models.OrderArray, error)
-	UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) error
+	AddWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, processed int64) error
+	ClaimOrdersInWork(ctx context.Context, owner string, limit int, lease time.Duration, filter models.ClaimFilter) (models.OrderArray, error)
+	RescheduleOrder(ctx context.Context, numOrder int64, owner string, attempts int, nextPollAt int64) error
+	UpdateOrdersBatch(ctx context.Context, orders models.ResAccrualOrderArray) (models.ProcessedOrderArray, error)
+	MarkOrderNotRegistered(ctx context.Context, numOrder int64, seenAt int64, grace time.Duration) error
+	RecordOrderFailure(ctx context.Context, numOrder int64, owner string, lastErr string, maxFailures int, nextPollAt int64) (bool, error)
+	GetDeadLetterOrders(ctx context.Context) (models.DeadLetterOrderArray, error)
+	GetDeadLetterOrder(ctx context.Context, numOrder int64) (*models.DeadLetterOrder, error)
+	RequeueDeadLetterOrder(ctx context.Context, numOrder int64) error
+	AddAdjustment(ctx context.Context, userID int64, amount models.Money, description string, created int64) error
+	GetStatement(ctx context.Context, userID int64, limit int, offset int) (models.LedgerEntryArray, error)
+	CheckBalances(ctx context.Context) (models.BalanceDriftArray, error)
+	ReserveIdempotencyKey(ctx context.Context, record *models.IdempotencyRecord, expiredBefore int64) (*models.IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, userID int64, key string, status int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, userID int64, key string) error
+	PurgeIdempotencyKeys(ctx context.Context, before int64) (int64, error)
+	RememberCallbackSignature(ctx context.Context, signature string, expiresAt int64) (bool, error)
+	PurgeCallbackSignatures(ctx context.Context, before int64) (int64, error)
+	ReverseWithdrawal(ctx context.Context, numOrder int64, sum models.Money, operator string, reason string, processed int64) (*models.Withdrawals, error)
+	ReserveWithdraw(ctx context.Context, numOrder int64, userID int64, sum models.Money, created int64, expires int64) (*models.Reservation, error)
+	ConfirmReservation(ctx context.Context, numOrder int64, userID int64, now int64) error
+	CancelReservation(ctx context.Context, numOrder int64, userID int64, now int64) error
+	ExpireReservations(ctx context.Context, now int64) (int64, error)
+	GetExpiringPoints(ctx context.Context, userID int64, before int64) (models.ExpiringPointsArray, error)
+	ExpirePoints(ctx context.Context, now int64) (models.Money, error)
+	GetLifetimeAccrual(ctx context.Context, userID int64) (models.Money, error)
+	SetUserTier(ctx context.Context, userID int64, tier string, changedAt int64) (string, error)
+	UserByID(ctx context.Context, userID int64) (*models.User, error)
+	ClaimProcessedOrders(ctx context.Context, limit int, now int64, lease time.Duration) (models.ProcessedOrderArray, error)
+	AckProcessedOrder(ctx context.Context, numOrder int64) error
+	RetryProcessedOrder(ctx context.Context, numOrder int64, lastErr string, nextAttemptAt int64) error
+	AddOrderBonus(ctx context.Context, numOrder int64, userID int64, bonuses models.OrderBonusArray, created int64) error
+	AddTransfer(ctx context.Context, fromUserID int64, toUserID int64, sum models.Money, limit models.TransferLimit, since int64, created int64) (*models.Transfer, error)
+	GetTransfers(ctx context.Context, userID int64) (models.TransferArray, error)
+	UserByReferralCode(ctx context.Context, code string) (*models.User, error)
+	AddReferralReward(ctx context.Context, reward models.ReferralReward) error
+	GetReferralStats(ctx context.Context, userID int64) (*models.ReferralStats, error)
 }
 
-func New(ctx context.Context, dsn string) (Storage, error) {
+func New(ctx context.Context, dsn string, pointsLifetimeMonths int) (Storage, error) {
 	const op = "storage.NewStorage"
 
-	store, err := postgres.NewPostgresStore(ctx, dsn)
+	store, err := postgres.NewPostgresStore(ctx, dsn, pointsLifetimeMonths)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	return store, nil
 }
+
+func NewMemory(pointsLifetimeMonths int) Storage {
+	return memory.NewMemoryStore(pointsLifetimeMonths)
+}
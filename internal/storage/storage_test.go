@@ -0,0 +1,665 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ArtShib/gophermart.git/internal/config"
+	"github.com/ArtShib/gophermart.git/internal/models"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var seq atomic.Int64
+
+// forEachStore runs fn against the in-memory store and, when DATABASE_URI is
+// set, against Postgres migrated into a throwaway schema.
+func forEachStore(t *testing.T, fn func(t *testing.T, store Storage)) {
+	t.Helper()
+
+	t.Run("memory", func(t *testing.T) {
+		store := NewMemory(config.DefaultPointsLifetimeMonths)
+		t.Cleanup(func() { store.Close() })
+		fn(t, store)
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("DATABASE_URI")
+		if dsn == "" {
+			t.Skip("DATABASE_URI is not set")
+		}
+		fn(t, newPostgres(t, dsn))
+	})
+}
+
+func newPostgres(t *testing.T, dsn string) Storage {
+	t.Helper()
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := fmt.Sprintf("gophermart_test_%d_%d", time.Now().UnixNano(), seq.Add(1))
+	if _, err := db.Exec("create schema " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("drop schema " + schema + " cascade"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store, err := New(ctx, withSearchPath(dsn, schema), config.DefaultPointsLifetimeMonths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", schema)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+func newUser(t *testing.T, store Storage, login string) *models.User {
+	t.Helper()
+
+	n := seq.Add(1)
+	user, err := store.SaveUser(context.Background(), fmt.Sprintf("%s-%d", login, n), []byte("hash"), fmt.Sprintf("CODE%04d", n), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func balanceOf(t *testing.T, store Storage, userID int64) *models.Balance {
+	t.Helper()
+
+	balance, err := store.GetBalance(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func checkNoDrift(t *testing.T, store Storage) {
+	t.Helper()
+
+	drifts, err := store.CheckBalances(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("balance drift: got %+v", drifts)
+	}
+}
+
+func TestUpdateOrdersBatchCollapsesDuplicates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "batch")
+		if err := store.AddOrder(ctx, 12345678903, time.Now().Unix(), user.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		processed, err := store.UpdateOrdersBatch(ctx, models.ResAccrualOrderArray{
+			{OrderNum: 12345678903, Status: models.StatusProcessing},
+			{OrderNum: 12345678903, Status: models.StatusProcessed, Accrual: 10000},
+			{OrderNum: 12345678903, Status: models.StatusProcessing},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(processed) != 1 || processed[0].Accrual != 10000 {
+			t.Fatalf("processed: got %+v", processed)
+		}
+
+		orders, err := store.GetOrder(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orders) != 1 || orders[0].Status != models.StatusProcessed || orders[0].Accrual != 10000 {
+			t.Fatalf("orders: got %+v", orders)
+		}
+
+		processed, err = store.UpdateOrdersBatch(ctx, models.ResAccrualOrderArray{
+			{OrderNum: 12345678903, Status: models.StatusProcessed, Accrual: 10000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(processed) != 0 {
+			t.Fatalf("processed twice: got %+v", processed)
+		}
+		if balance := balanceOf(t, store, user.ID); balance.Current != 10000 {
+			t.Fatalf("balance: got %+v", balance)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+// accrue credits amount to a fresh order of user and returns when it was earned.
+func accrue(t *testing.T, store Storage, user *models.User, numOrder int64, amount models.Money) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := store.AddOrder(ctx, numOrder, time.Now().Unix(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+	processed, err := store.UpdateOrdersBatch(ctx, models.ResAccrualOrderArray{
+		{OrderNum: numOrder, Status: models.StatusProcessed, Accrual: amount},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 1 {
+		t.Fatalf("order %d not processed: got %+v", numOrder, processed)
+	}
+	return processed[0].ProcessedAt
+}
+
+// expiringByDay returns the user's points per expiry day, up to far in the future.
+func expiringByDay(t *testing.T, store Storage, userID int64) map[int64]models.Money {
+	t.Helper()
+
+	expiring, err := store.GetExpiringPoints(context.Background(), userID, time.Now().AddDate(10, 0, 0).Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byDay := make(map[int64]models.Money)
+	for _, points := range expiring {
+		byDay[points.Date] += points.Amount
+	}
+	return byDay
+}
+
+func TestTransferCarriesLotExpiry(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		sender := newUser(t, store, "sender")
+		recipient := newUser(t, store, "recipient")
+		earned := accrue(t, store, sender, 12345678903, 10000)
+		day := models.ExpiryDay(models.PointsExpireAt(earned, config.DefaultPointsLifetimeMonths))
+
+		later := time.Now().AddDate(0, 3, 0).Unix()
+		_, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 6000, models.TransferLimit{}, later-86400, later)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := expiringByDay(t, store, recipient.ID); len(got) != 1 || got[day] != 6000 {
+			t.Fatalf("recipient expiring: got %v, want 6000 on %d", got, day)
+		}
+		if got := expiringByDay(t, store, sender.ID); len(got) != 1 || got[day] != 4000 {
+			t.Fatalf("sender expiring: got %v, want 4000 on %d", got, day)
+		}
+
+		expired, err := store.ExpirePoints(ctx, models.PointsExpireAt(earned, config.DefaultPointsLifetimeMonths))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != 10000 {
+			t.Fatalf("expired: got %v, want 10000", expired)
+		}
+		if balance := balanceOf(t, store, recipient.ID); balance.Current != 0 {
+			t.Fatalf("recipient balance: got %+v", balance)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestReversalRestoresSpentLots(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "reversal")
+		earned := accrue(t, store, user, 12345678903, 10000)
+		day := models.ExpiryDay(models.PointsExpireAt(earned, config.DefaultPointsLifetimeMonths))
+
+		if err := store.AddWithdraw(ctx, 2377225624, user.ID, 4000, time.Now().Unix()); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().AddDate(0, 3, 0).Unix()
+		if _, err := store.ReverseWithdrawal(ctx, 2377225624, 1500, "ops", "partial", later); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReverseWithdrawal(ctx, 2377225624, 0, "ops", "rest", later); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := expiringByDay(t, store, user.ID); len(got) != 1 || got[day] != 10000 {
+			t.Fatalf("expiring: got %v, want 10000 on %d", got, day)
+		}
+		if balance := balanceOf(t, store, user.ID); balance.Current != 10000 || balance.Withdrawn != 0 {
+			t.Fatalf("balance: got %+v", balance)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestProcessedOrdersOutbox(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "outbox")
+		for _, number := range []int64{12345678903, 79927398713} {
+			if err := store.AddOrder(ctx, number, time.Now().Unix(), user.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, number := range []int64{79927398713, 12345678903} {
+			_, err := store.UpdateOrdersBatch(ctx, models.ResAccrualOrderArray{
+				{OrderNum: number, Status: models.StatusProcessed, Accrual: 10000},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		now := time.Now().Unix()
+		events, err := store.ClaimProcessedOrders(ctx, 10, now, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		positions := map[int64]int{}
+		lifetimes := map[int64]models.Money{}
+		for _, event := range events {
+			if event.UserID != user.ID || event.Accrual != 10000 || event.ProcessedAt == 0 {
+				t.Fatalf("event: got %+v", event)
+			}
+			positions[event.OrderNum] = event.Position
+			lifetimes[event.OrderNum] = event.LifetimeAccrual
+		}
+		if len(events) != 2 || positions[79927398713] != 1 || positions[12345678903] != 2 {
+			t.Fatalf("positions must follow processing order: got %v", positions)
+		}
+		if lifetimes[79927398713] != 10000 || lifetimes[12345678903] != 20000 {
+			t.Fatalf("lifetime accrual must be taken as each order was processed: got %v", lifetimes)
+		}
+
+		if again, err := store.ClaimProcessedOrders(ctx, 10, now, time.Minute); err != nil || len(again) != 0 {
+			t.Fatalf("leased events claimed again: got %+v, %v", again, err)
+		}
+
+		if err := store.AckProcessedOrder(ctx, 79927398713); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RetryProcessedOrder(ctx, 12345678903, "campaigns: boom", now+5); err != nil {
+			t.Fatal(err)
+		}
+		if early, err := store.ClaimProcessedOrders(ctx, 10, now+4, time.Minute); err != nil || len(early) != 0 {
+			t.Fatalf("event claimed before its retry: got %+v, %v", early, err)
+		}
+		retried, err := store.ClaimProcessedOrders(ctx, 10, now+5, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(retried) != 1 || retried[0].OrderNum != 12345678903 || retried[0].Attempts != 1 || retried[0].Position != 2 {
+			t.Fatalf("retried: got %+v", retried)
+		}
+	})
+}
+
+func TestClaimOrdersInWorkLeasesAndFilters(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "claim")
+		partner := newUser(t, store, "partner")
+		for _, order := range []struct {
+			number int64
+			userID int64
+		}{{12345678903, user.ID}, {9001, user.ID}, {79927398713, partner.ID}} {
+			if err := store.AddOrder(ctx, order.number, time.Now().Unix(), order.userID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		filter := models.ClaimFilter{Routes: []models.ClaimRoute{
+			{Prefix: "9", Skip: true},
+			{UserIDs: []int64{partner.ID}, Skip: true},
+		}}
+		claimed, err := store.ClaimOrdersInWork(ctx, "a", 10, time.Minute, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 1 || claimed[0].Number != 12345678903 {
+			t.Fatalf("claimed with filter: got %+v", claimed)
+		}
+
+		claimed, err = store.ClaimOrdersInWork(ctx, "b", 10, time.Minute, models.ClaimFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != 2 {
+			t.Fatalf("claimed unleased orders: got %+v", claimed)
+		}
+		if _, err := store.ClaimOrdersInWork(ctx, "c", 10, time.Minute, models.ClaimFilter{}); !errors.Is(err, models.ErrOrdersInWorkIsEmpty) {
+			t.Fatalf("claim with everything leased: got %v", err)
+		}
+
+		_, err = store.ClaimOrdersInWork(ctx, "d", 10, time.Minute, models.ClaimFilter{SkipDefault: true})
+		if !errors.Is(err, models.ErrOrdersInWorkIsEmpty) {
+			t.Fatalf("claim skipping the default provider: got %v", err)
+		}
+	})
+}
+
+func TestWithdrawals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "withdraw")
+		accrue(t, store, user, 12345678903, 10000)
+		now := time.Now().Unix()
+
+		for _, sum := range []models.Money{0, -100} {
+			if err := store.AddWithdraw(ctx, 2377225624, user.ID, sum, now); !errors.Is(err, models.ErrInvalidWithdrawSum) {
+				t.Fatalf("withdraw %v: got %v", sum, err)
+			}
+		}
+		if err := store.AddWithdraw(ctx, 2377225624, user.ID, 20000, now); !errors.Is(err, models.ErrWithdrawBalanceUser) {
+			t.Fatalf("withdraw above balance: got %v", err)
+		}
+		if err := store.AddWithdraw(ctx, 2377225624, user.ID, 2500, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddWithdraw(ctx, 2377225624, user.ID, 100, now); !errors.Is(err, models.ErrWithdrawalExists) {
+			t.Fatalf("repeated withdrawal: got %v", err)
+		}
+
+		if balance := balanceOf(t, store, user.ID); balance.Current != 7500 || balance.Withdrawn != 2500 {
+			t.Fatalf("balance: got %+v", balance)
+		}
+		withdrawals, err := store.GetWithdrawals(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(withdrawals) != 1 || withdrawals[0].OrderNum != 2377225624 || withdrawals[0].Sum != 2500 {
+			t.Fatalf("withdrawals: got %+v", withdrawals)
+		}
+
+		if _, err := store.ReverseWithdrawal(ctx, 2377225624, 3000, "ops", "too much", now); !errors.Is(err, models.ErrReversalTooLarge) {
+			t.Fatalf("reversal above the withdrawal: got %v", err)
+		}
+		if _, err := store.ReverseWithdrawal(ctx, 1111111111, 0, "ops", "unknown", now); !errors.Is(err, models.ErrWithdrawalNotFound) {
+			t.Fatalf("reversal of unknown withdrawal: got %v", err)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestWithdrawalReservations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "reserve")
+		accrue(t, store, user, 12345678903, 10000)
+		now := time.Now().Unix()
+
+		if _, err := store.ReserveWithdraw(ctx, 2377225624, user.ID, 4000, now, now+60); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReserveWithdraw(ctx, 2377225624, user.ID, 100, now, now+60); !errors.Is(err, models.ErrWithdrawalExists) {
+			t.Fatalf("repeated reservation: got %v", err)
+		}
+		if _, err := store.ReserveWithdraw(ctx, 4561261212345467, user.ID, 7000, now, now+60); !errors.Is(err, models.ErrWithdrawBalanceUser) {
+			t.Fatalf("reservation above the available balance: got %v", err)
+		}
+		if balance := balanceOf(t, store, user.ID); balance.Current != 6000 || balance.Reserved != 4000 {
+			t.Fatalf("balance while reserved: got %+v", balance)
+		}
+
+		if _, err := store.ReserveWithdraw(ctx, 4561261212345467, user.ID, 1000, now, now+60); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReserveWithdraw(ctx, 49927398716, user.ID, 1000, now, now+1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.ConfirmReservation(ctx, 2377225624, user.ID, now+10); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CancelReservation(ctx, 4561261212345467, user.ID, now+10); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ConfirmReservation(ctx, 4561261212345467, user.ID, now+10); !errors.Is(err, models.ErrReservationClosed) {
+			t.Fatalf("confirm after cancel: got %v", err)
+		}
+		if err := store.CancelReservation(ctx, 2377225624, newUser(t, store, "stranger").ID, now+10); !errors.Is(err, models.ErrReservationNotFound) {
+			t.Fatalf("cancel by another user: got %v", err)
+		}
+
+		expired, err := store.ExpireReservations(ctx, now+10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != 1 {
+			t.Fatalf("expired: got %d, want 1", expired)
+		}
+		if err := store.ConfirmReservation(ctx, 49927398716, user.ID, now+10); !errors.Is(err, models.ErrReservationExpired) {
+			t.Fatalf("confirm after expiry: got %v", err)
+		}
+
+		if balance := balanceOf(t, store, user.ID); balance.Current != 6000 || balance.Withdrawn != 4000 || balance.Reserved != 0 {
+			t.Fatalf("balance after resolving: got %+v", balance)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestExpirePoints(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "expire")
+		earned := accrue(t, store, user, 12345678903, 10000)
+		if err := store.AddWithdraw(ctx, 2377225624, user.ID, 3000, earned); err != nil {
+			t.Fatal(err)
+		}
+		expiresAt := models.PointsExpireAt(earned, config.DefaultPointsLifetimeMonths)
+
+		if expired, err := store.ExpirePoints(ctx, expiresAt-1); err != nil || expired != 0 {
+			t.Fatalf("expire early: got %v, %v", expired, err)
+		}
+		expired, err := store.ExpirePoints(ctx, expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != 7000 {
+			t.Fatalf("expired: got %v, want 7000", expired)
+		}
+		if balance := balanceOf(t, store, user.ID); balance.Current != 0 || balance.Withdrawn != 3000 {
+			t.Fatalf("balance: got %+v", balance)
+		}
+		if expired, err := store.ExpirePoints(ctx, expiresAt); err != nil || expired != 0 {
+			t.Fatalf("expire twice: got %v, %v", expired, err)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestTransfers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		sender := newUser(t, store, "sender")
+		recipient := newUser(t, store, "recipient")
+		accrue(t, store, sender, 12345678903, 10000)
+		now := time.Now().Unix()
+		limit := models.TransferLimit{DailySum: 5000, DailyCount: 2}
+
+		if _, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 20000, limit, now-86400, now); !errors.Is(err, models.ErrWithdrawBalanceUser) {
+			t.Fatalf("transfer above balance: got %v", err)
+		}
+		transfer, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 3000, limit, now-86400, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transfer.FromLogin != sender.Login || transfer.ToLogin != recipient.Login || transfer.Sum != 3000 {
+			t.Fatalf("transfer: got %+v", transfer)
+		}
+		if _, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 2500, limit, now-86400, now); !errors.Is(err, models.ErrTransferLimit) {
+			t.Fatalf("transfer above the daily sum: got %v", err)
+		}
+		if _, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 2000, limit, now-86400, now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddTransfer(ctx, sender.ID, recipient.ID, 100, models.TransferLimit{DailyCount: 2}, now-86400, now); !errors.Is(err, models.ErrTransferLimit) {
+			t.Fatalf("transfer above the daily count: got %v", err)
+		}
+
+		if balance := balanceOf(t, store, sender.ID); balance.Current != 5000 {
+			t.Fatalf("sender balance: got %+v", balance)
+		}
+		if balance := balanceOf(t, store, recipient.ID); balance.Current != 5000 {
+			t.Fatalf("recipient balance: got %+v", balance)
+		}
+		transfers, err := store.GetTransfers(ctx, recipient.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transfers) != 2 {
+			t.Fatalf("recipient transfers: got %+v", transfers)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestOrderBonusIsCreditedOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "bonus")
+		accrue(t, store, user, 12345678903, 10000)
+		bonuses := models.OrderBonusArray{{Campaign: "first-order", Amount: 5000}, {Campaign: "double-points", Amount: 10000}}
+
+		if err := store.AddOrderBonus(ctx, 12345678903, user.ID, bonuses, time.Now().Unix()); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddOrderBonus(ctx, 12345678903, user.ID, bonuses, time.Now().Unix()); !errors.Is(err, models.ErrBonusApplied) {
+			t.Fatalf("second bonus: got %v", err)
+		}
+		if err := store.AddOrderBonus(ctx, 79927398713, user.ID, bonuses, time.Now().Unix()); !errors.Is(err, models.ErrOrderNotFound) {
+			t.Fatalf("bonus for unknown order: got %v", err)
+		}
+
+		if balance := balanceOf(t, store, user.ID); balance.Current != 25000 {
+			t.Fatalf("balance: got %+v", balance)
+		}
+		lifetime, err := store.GetLifetimeAccrual(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lifetime != 10000 {
+			t.Fatalf("lifetime accrual must exclude bonuses: got %v", lifetime)
+		}
+		orders, err := store.GetOrder(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(orders) != 1 || orders[0].Bonus != 15000 {
+			t.Fatalf("orders: got %+v", orders)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestReferralRewardIsPaidOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		referrer := newUser(t, store, "referrer")
+		n := seq.Add(1)
+		referee, err := store.SaveUser(ctx, fmt.Sprintf("referee-%d", n), []byte("hash"), fmt.Sprintf("CODE%04d", n), referrer.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accrue(t, store, referee, 12345678903, 10000)
+
+		reward := models.ReferralReward{
+			ReferredUserID: referee.ID,
+			ReferrerID:     referrer.ID,
+			OrderNum:       12345678903,
+			ReferrerBonus:  10000,
+			RefereeBonus:   5000,
+			CreatedAt:      time.Now().Unix(),
+		}
+		if err := store.AddReferralReward(ctx, reward); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddReferralReward(ctx, reward); !errors.Is(err, models.ErrReferralRewarded) {
+			t.Fatalf("second reward: got %v", err)
+		}
+
+		stats, err := store.GetReferralStats(ctx, referrer.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Code != referrer.ReferralCode || stats.Referred != 1 || stats.Rewarded != 1 || stats.Earned != 10000 {
+			t.Fatalf("stats: got %+v", stats)
+		}
+		if balance := balanceOf(t, store, referrer.ID); balance.Current != 10000 {
+			t.Fatalf("referrer balance: got %+v", balance)
+		}
+		if balance := balanceOf(t, store, referee.ID); balance.Current != 15000 {
+			t.Fatalf("referee balance: got %+v", balance)
+		}
+		checkNoDrift(t, store)
+	})
+}
+
+func TestCallbackSignatures(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+
+		for _, want := range []bool{true, false} {
+			fresh, err := store.RememberCallbackSignature(ctx, "sha256=aa", 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fresh != want {
+				t.Fatalf("remember: got %v, want %v", fresh, want)
+			}
+		}
+		if _, err := store.RememberCallbackSignature(ctx, "sha256=bb", 200); err != nil {
+			t.Fatal(err)
+		}
+
+		purged, err := store.PurgeCallbackSignatures(ctx, 150)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 1 {
+			t.Fatalf("purged: got %d, want 1", purged)
+		}
+		if fresh, err := store.RememberCallbackSignature(ctx, "sha256=bb", 200); err != nil || fresh {
+			t.Fatalf("unexpired signature was purged: fresh %v, err %v", fresh, err)
+		}
+	})
+}
+
+func TestSaveUserTellsLoginAndReferralCodeCollisionsApart(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Storage) {
+		ctx := context.Background()
+		user := newUser(t, store, "taken")
+
+		if _, err := store.SaveUser(ctx, user.Login, []byte("hash"), "FRESHCODE1", 0); !errors.Is(err, models.ErrUserExists) {
+			t.Fatalf("duplicate login: got %v", err)
+		}
+		if _, err := store.SaveUser(ctx, user.Login+"-free", []byte("hash"), user.ReferralCode, 0); !errors.Is(err, models.ErrReferralCodeTaken) {
+			t.Fatalf("duplicate referral code: got %v", err)
+		}
+	})
+}